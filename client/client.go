@@ -1,12 +1,13 @@
 package client
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -33,8 +34,7 @@ type Client interface {
 // Do function from http client with rate limit
 func (c RateClient) Do(req *http.Request) (*http.Response, error) {
 
-	ctx := context.Background()
-	err := c.RateLimiter.Wait(ctx)
+	err := c.RateLimiter.Wait(req.Context())
 
 	if err != nil {
 		return nil, err
@@ -79,9 +79,11 @@ func NewRateClient(proxyAddr string, validateCert bool, timeout int, rateTime in
 }
 
 type argumentsURL struct {
-	Paused      bool   `json:"paused"`
-	DownloadDir string `json:"download-dir"`
-	Filename    string `json:"filename"`
+	Paused            bool   `json:"paused"`
+	DownloadDir       string `json:"download-dir"`
+	Filename          string `json:"filename"`
+	BandwidthPriority *int   `json:"bandwidthPriority,omitempty"`
+	PeerLimit         *int   `json:"peer-limit,omitempty"`
 }
 
 type argumentsTorrent struct {
@@ -100,6 +102,28 @@ type addFile struct {
 	Arguments argumentsTorrent `json:"arguments"`
 }
 
+type argumentsSet struct {
+	IDs            []string `json:"ids"`
+	SeedRatioLimit float64  `json:"seedRatioLimit,omitempty"`
+	SeedRatioMode  int      `json:"seedRatioMode,omitempty"`
+	SeedIdleLimit  int      `json:"seedIdleLimit,omitempty"`
+	SeedIdleMode   int      `json:"seedIdleMode,omitempty"`
+	Labels         []string `json:"labels,omitempty"`
+	QueuePosition  *int     `json:"queuePosition,omitempty"`
+}
+
+type setTorrentArgs struct {
+	Method    string       `json:"method"`
+	Arguments argumentsSet `json:"arguments"`
+}
+
+type respSet struct {
+	Result string `json:"result"`
+}
+
+// errTorrentRejected returned when the RPC server answers but does not add the torrent
+var errTorrentRejected = errors.New("Unable to add torrent")
+
 type respTorrent struct {
 	Arguments struct {
 		TorrentAdded struct {
@@ -116,43 +140,152 @@ type respTorrent struct {
 	Result string `json:"result"`
 }
 
-func addTorrentURL(items <-chan TorrentReq, client *RPCClient, connection config.Connect, seen helper.SeenTorrent) {
+// sleepContext waits for the duration or until the context is canceled
+func sleepContext(ctx context.Context, d time.Duration) error {
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// addTorrentURL adds the queued torrents, the cache entry of a feed is dropped
+// when one of its torrents is not added so the next poll retrieves it again,
+// and the torrent is kept as pending when the state backend keeps them
+func addTorrentURL(ctx context.Context, items <-chan TorrentReq, client *RPCClient, connection config.Connect, seen helper.SeenTorrent, cache helper.FeedCache, history helper.EpisodeHistory, pending helper.PendingTorrents) {
 
 	defer wc.Done()
 
 	for item := range items {
 
-		data := addURL{
-			Method: "torrent-add",
-			Arguments: argumentsURL{
-				Paused:      true,
-				DownloadDir: item.DownloadPath,
-				Filename:    item.Link,
-			},
+		// Drain the queue without adding once shutdown started
+		if ctx.Err() != nil {
+			logger.Info("Shutting down, skipping torrent: %v\n", item.Title)
+			if cache != nil {
+				cache.Delete(item.Feed)
+			}
+			if pending != nil {
+				pending.Put(pendingAddPrefix+item.UID, item)
+			}
+			seen.Release(item.UID)
+			releaseEpisode(item, history)
+			continue
 		}
 
-		jsonData, _ := json.Marshal(data)
+		hasFallback := len(item.Magnet) != 0 && item.Magnet != item.Link
 
-		var i int
-		for ; i < connection.Retries; i++ {
-			err := addTorrent(jsonData, client)
-			if err != nil {
-				logger.Error("%v", err)
-				logger.Error("Waiting %v seconds until retry\n", connection.WaitTime)
-				time.Sleep(time.Duration(connection.WaitTime) * time.Second)
+		hashString, err := addLink(ctx, item, item.Link, client, connection, hasFallback)
+		if err != nil && hasFallback && ctx.Err() == nil {
+			logger.Warn("Could not add torrent from %v, falling back to magnet: %v\n", item.Link, item.Magnet)
+			hashString, err = addLink(ctx, item, item.Magnet, client, connection, false)
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				logger.Info("Shutting down, could not add torrent: %v\n", item.Link)
 			} else {
-				seen.AddSeen(item.Title)
-				break
+				logger.Error("%v\n", err)
 			}
+			if cache != nil {
+				cache.Delete(item.Feed)
+			}
+			if pending != nil {
+				pending.Put(pendingAddPrefix+item.UID, item)
+			}
+			seen.Release(item.UID)
+			releaseEpisode(item, history)
+			continue
+		}
+
+		seen.AddSeen(item.seenEntry())
+		if pending != nil {
+			pending.Delete(pendingAddPrefix + item.UID)
+		}
+		if history != nil && len(item.EpisodeKey) != 0 {
+			history.Commit(item.EpisodeKey, item.EpisodeEntry)
+		}
+
+		err = setTorrentOptions(ctx, item, hashString, client)
+		if err != nil {
+			logger.Error("Could not set options of %v: %v\n", item.Title, err)
+		}
+	}
+}
+
+// releaseEpisode drops the episode claim of a torrent that was not added
+func releaseEpisode(item TorrentReq, history helper.EpisodeHistory) {
+
+	if history != nil && len(item.EpisodeKey) != 0 {
+		history.Release(item.EpisodeKey, item.EpisodeEntry)
+	}
+}
+
+// addLink sends the link to the RPC server retrying on failures, torrents
+// rejected by the server are not retried when there is a fallback link
+func addLink(ctx context.Context, item TorrentReq, link string, client *RPCClient, connection config.Connect, hasFallback bool) (string, error) {
+
+	data := addURL{
+		Method: "torrent-add",
+		Arguments: argumentsURL{
+			Paused:            item.AddOptions.Paused == nil || *item.AddOptions.Paused,
+			DownloadDir:       item.DownloadPath,
+			Filename:          link,
+			BandwidthPriority: item.AddOptions.BandwidthPriority,
+			PeerLimit:         item.AddOptions.PeerLimit,
+		},
+	}
+
+	jsonData, _ := json.Marshal(data)
+
+	for i := 0; i < connection.Retries; i++ {
+
+		hashString, err := addTorrent(ctx, jsonData, client)
+		if err == nil {
+			return hashString, nil
+		}
+
+		logger.Error("%v", err)
+		if hasFallback && errors.Is(err, errTorrentRejected) {
+			return "", err
 		}
 
-		if i == connection.Retries {
-			logger.Error("All %v retries failed could not add torrent %v\n", i, item.Link)
+		logger.Error("Waiting %v seconds until retry\n", connection.WaitTime)
+		err = sleepContext(ctx, time.Duration(connection.WaitTime)*time.Second)
+		if err != nil {
+			return "", err
 		}
 	}
+
+	return "", fmt.Errorf("All %v retries failed could not add torrent %v", connection.Retries, link)
+}
+
+// reportTorrent prints the torrents that would be added without contacting
+// the RPC server, they are neither marked as seen nor grabbed
+func reportTorrent(items <-chan TorrentReq, out io.Writer, seen helper.SeenTorrent, history helper.EpisodeHistory) {
+
+	defer wc.Done()
+
+	for item := range items {
+		seen.Release(item.UID)
+		releaseEpisode(item, history)
+		fmt.Fprintf(
+			out,
+			"Feed:          %v\nMatcher:       %v\nTitle:         %v\nLink:          %v\nDownload path: %v\n\n",
+			item.Feed,
+			item.Matcher,
+			item.Title,
+			item.Link,
+			item.DownloadPath,
+		)
+	}
 }
 
-func addTorrentFile(items <-chan TorrentReq, clientRPC *RPCClient, connection config.Connect, client Client, seen helper.SeenTorrent) {
+func addTorrentFile(ctx context.Context, items <-chan TorrentReq, clientRPC *RPCClient, connection config.Connect, client Client, seen helper.SeenTorrent) {
 
 	for item := range items {
 
@@ -190,11 +323,11 @@ func addTorrentFile(items <-chan TorrentReq, clientRPC *RPCClient, connection co
 		jsonData, _ := json.Marshal(data)
 
 		for i := 0; i < connection.Retries; i++ {
-			err := addTorrent(jsonData, clientRPC)
+			_, err := addTorrent(ctx, jsonData, clientRPC)
 			if err != nil {
 				logger.Error("%v", err)
 			} else {
-				seen.AddSeen(item.Title)
+				seen.AddSeen(item.seenEntry())
 				break
 			}
 		}
@@ -202,23 +335,85 @@ func addTorrentFile(items <-chan TorrentReq, clientRPC *RPCClient, connection co
 	}
 }
 
-func addTorrent(data []byte, client *RPCClient) error {
+// seedMode converts a configured limit to the Transmission seed mode, positive
+// values set the torrent own limit, negative ones seed without limit and zero
+// keeps the session limits
+func seedMode(limit float64) int {
+
+	switch {
+	case limit > 0:
+		return 1
+	case limit < 0:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// setTorrentOptions applies the seeding policy of the feed and the options
+// torrent-add does not accept to the added torrent
+func setTorrentOptions(ctx context.Context, item TorrentReq, hashString string, client *RPCClient) error {
 
-	req, err := http.NewRequest("POST", client.URL, bytes.NewBuffer(data))
+	if item.SeedRatioLimit == 0 && item.SeedIdleLimit == 0 &&
+		len(item.AddOptions.Labels) == 0 && item.AddOptions.QueuePosition == nil {
+		return nil
+	}
+
+	if len(hashString) == 0 {
+		return fmt.Errorf("Torrent hash not returned by the RPC server")
+	}
+
+	args := argumentsSet{
+		IDs:           []string{hashString},
+		SeedRatioMode: seedMode(item.SeedRatioLimit),
+		SeedIdleMode:  seedMode(float64(item.SeedIdleLimit)),
+		Labels:        item.AddOptions.Labels,
+		QueuePosition: item.AddOptions.QueuePosition,
+	}
+	if item.SeedRatioLimit > 0 {
+		args.SeedRatioLimit = item.SeedRatioLimit
+	}
+	if item.SeedIdleLimit > 0 {
+		args.SeedIdleLimit = item.SeedIdleLimit
+	}
+
+	jsonData, _ := json.Marshal(setTorrentArgs{
+		Method:    "torrent-set",
+		Arguments: args,
+	})
+
+	logger.Info("Setting options of %v: %s\n", hashString, jsonData)
+
+	return setTorrent(ctx, jsonData, client)
+}
+
+func setTorrent(ctx context.Context, data []byte, client *RPCClient) error {
+
+	resp, err := client.Post(ctx, data)
 	if err != nil {
-		logger.Error("Unable to create POST request: %v\n", err)
 		return err
 	}
+	defer resp.Body.Close()
 
-	req.SetBasicAuth(client.Creds.Username, client.Creds.Password)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Transmission-Session-Id", client.SessionID)
+	var body respSet
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		logger.Error("Unable to parse response body JSON:%v\n%v\n", err, resp.Body)
+		return err
+	}
 
-	resp, err := client.Client.Do(req)
+	if body.Result != "success" {
+		return fmt.Errorf("Unable to set torrent: %v", body)
+	}
 
+	return nil
+}
+
+func addTorrent(ctx context.Context, data []byte, client *RPCClient) (string, error) {
+
+	resp, err := client.Post(ctx, data)
 	if err != nil {
-		logger.Error("Error during POST request: %v\n", err)
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -226,11 +421,11 @@ func addTorrent(data []byte, client *RPCClient) error {
 	err = json.NewDecoder(resp.Body).Decode(&body)
 	if err != nil {
 		logger.Error("Unable to parse response body JSON:%v\n%v\n", err, resp.Body)
-		return err
+		return "", err
 	}
 
 	if body.Result != "success" {
-		return fmt.Errorf("Unable to add torrent: %v", body)
+		return "", fmt.Errorf("%w: %v", errTorrentRejected, body)
 	}
 
 	hashString := body.Arguments.TorrentAdded.HashString
@@ -243,5 +438,5 @@ func addTorrent(data []byte, client *RPCClient) error {
 		}
 	}
 
-	return nil
+	return hashString, nil
 }
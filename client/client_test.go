@@ -1,13 +1,22 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/whatust/transmission-rss/config"
+	"github.com/whatust/transmission-rss/helper"
 )
 
 func TestNewRateClient(t *testing.T) {
@@ -75,10 +84,264 @@ func TestAddTorrent(t *testing.T) {
 			},
 			Client: server.Client(),
 		}
-		err := addTorrent(test.sentData, &clientRPC)
+		_, err := addTorrent(context.Background(), test.sentData, &clientRPC)
 
 		if (err == nil) != (test.expected == nil) {
 			t.Errorf("Test %v Failed: expected %v, received %v", idx, test.expected, err)
 		}
 	}
 }
+
+func TestReportTorrent(t *testing.T) {
+
+	var tests = []struct {
+		items    []TorrentReq
+		expected string
+	}{
+		{[]TorrentReq{}, ""},
+		{
+			[]TorrentReq{
+				{
+					Feed:         "http://feed.com",
+					Matcher:      "regexp",
+					Title:        "title",
+					Link:         "http://example.com",
+					DownloadPath: "/downloads",
+				},
+			},
+			"Feed:          http://feed.com\nMatcher:       regexp\nTitle:         title\nLink:          http://example.com\nDownload path: /downloads\n\n",
+		},
+	}
+
+	for idx, test := range tests {
+
+		var out bytes.Buffer
+		channel := make(chan TorrentReq, len(test.items))
+
+		for _, item := range test.items {
+			channel <- item
+		}
+		close(channel)
+
+		wc.Add(1)
+		reportTorrent(channel, &out, &helper.SeenSet{}, nil)
+
+		if out.String() != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %q\nExpected: %q", idx, out.String(), test.expected)
+		}
+	}
+
+	// Reported episodes are not grabbed so later polls report them again
+	history := &helper.HistoryMap{}
+	entry := helper.HistoryEntry{Title: "Show - 01", Quality: "1080p"}
+	history.Claim("show E01", entry, nil)
+
+	channel := make(chan TorrentReq, 1)
+	channel <- TorrentReq{Title: "Show - 01", EpisodeKey: "show E01", EpisodeEntry: entry}
+	close(channel)
+
+	wc.Add(1)
+	reportTorrent(channel, ioutil.Discard, &helper.SeenSet{}, history)
+
+	if !history.Claim("show E01", entry, nil) {
+		t.Errorf("Test Failed: reported episode still claimed")
+	}
+}
+
+func TestAddTorrentURLCanceled(t *testing.T) {
+
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprintf(w, "{\"result\":\"success\"}")
+	}))
+	defer server.Close()
+
+	clientRPC := RPCClient{
+		URL:    server.URL,
+		Client: server.Client(),
+	}
+
+	seen := helper.SeenSet{
+		Old: make(map[string]helper.SeenEntry),
+		New: make(map[string]helper.SeenEntry),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	channel := make(chan TorrentReq, 2)
+	channel <- TorrentReq{Title: "title1", UID: "title1", Link: "http://example1.com"}
+	channel <- TorrentReq{Title: "title2", UID: "title2", Link: "http://example2.com"}
+	close(channel)
+
+	wc.Add(1)
+	addTorrentURL(ctx, channel, &clientRPC, config.Connect{Retries: 1}, &seen, nil, nil, nil)
+
+	if requests != 0 {
+		t.Errorf("Test Failed: %v requests sent after shutdown", requests)
+	}
+
+	if seen.Contain("title1") || seen.Contain("title2") {
+		t.Errorf("Test Failed: torrents marked as seen after shutdown")
+	}
+}
+
+func TestSetTorrentOptions(t *testing.T) {
+
+	var tests = []struct {
+		item       TorrentReq
+		hashString string
+		expected   string
+		expectErr  bool
+	}{
+		{TorrentReq{}, "hashstring", "", false},
+		{TorrentReq{SeedRatioLimit: 1.5}, "", "", true},
+		{
+			TorrentReq{SeedRatioLimit: 1.5},
+			"hashstring",
+			"{\"method\":\"torrent-set\",\"arguments\":{\"ids\":[\"hashstring\"],\"seedRatioLimit\":1.5,\"seedRatioMode\":1}}",
+			false,
+		},
+		{
+			TorrentReq{SeedRatioLimit: -1, SeedIdleLimit: 30},
+			"hashstring",
+			"{\"method\":\"torrent-set\",\"arguments\":{\"ids\":[\"hashstring\"],\"seedRatioMode\":2,\"seedIdleLimit\":30,\"seedIdleMode\":1}}",
+			false,
+		},
+		{
+			TorrentReq{AddOptions: config.AddOptions{Labels: []string{"tv", "anime"}, QueuePosition: intPtr(0)}},
+			"hashstring",
+			"{\"method\":\"torrent-set\",\"arguments\":{\"ids\":[\"hashstring\"],\"labels\":[\"tv\",\"anime\"],\"queuePosition\":0}}",
+			false,
+		},
+	}
+
+	for idx, test := range tests {
+
+		var received string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := ioutil.ReadAll(r.Body)
+			received = string(data)
+			fmt.Fprintf(w, "{\"result\":\"success\"}")
+		}))
+
+		clientRPC := RPCClient{
+			URL:    server.URL,
+			Client: server.Client(),
+		}
+
+		err := setTorrentOptions(context.Background(), test.item, test.hashString, &clientRPC)
+		server.Close()
+
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test %v Failed: unexpected error %v", idx, err)
+		}
+
+		if received != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, received, test.expected)
+		}
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestAddTorrentURLMagnetFallback(t *testing.T) {
+
+	var tests = []struct {
+		item     TorrentReq
+		expected []string
+		seen     bool
+	}{
+		{
+			TorrentReq{Title: "title1", UID: "title1", Link: "magnet:?xt=urn:btih:hash"},
+			[]string{"magnet:?xt=urn:btih:hash"},
+			true,
+		},
+		{
+			TorrentReq{Title: "title2", UID: "title2", Link: "http://example.com", Magnet: "magnet:?xt=urn:btih:hash"},
+			[]string{"http://example.com", "magnet:?xt=urn:btih:hash"},
+			true,
+		},
+		{
+			TorrentReq{Title: "title3", UID: "title3", Link: "http://example.com"},
+			[]string{"http://example.com", "http://example.com"},
+			false,
+		},
+	}
+
+	for idx, test := range tests {
+
+		var received []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var data addURL
+			json.NewDecoder(r.Body).Decode(&data)
+			received = append(received, data.Arguments.Filename)
+
+			if isMagnet(data.Arguments.Filename) {
+				fmt.Fprintf(w, "{\"result\":\"success\"}")
+			} else {
+				fmt.Fprintf(w, "{\"result\":\"gotMetadataFromURL: http error 404: Not Found\"}")
+			}
+		}))
+
+		clientRPC := RPCClient{
+			URL:    server.URL,
+			Client: server.Client(),
+		}
+
+		seen := helper.SeenSet{
+			Old: make(map[string]helper.SeenEntry),
+			New: make(map[string]helper.SeenEntry),
+		}
+
+		pending, cleanup := openPending(t)
+		defer cleanup()
+
+		channel := make(chan TorrentReq, 1)
+		channel <- test.item
+		close(channel)
+
+		wc.Add(1)
+		addTorrentURL(context.Background(), channel, &clientRPC, config.Connect{Retries: 2}, &seen, nil, nil, pending)
+		server.Close()
+
+		if !reflect.DeepEqual(received, test.expected) {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, received, test.expected)
+		}
+
+		if seen.Contain(test.item.UID) != test.seen {
+			t.Errorf("Test %v Failed: seen %v, expected %v", idx, !test.seen, test.seen)
+		}
+
+		// Torrents that were not added are queued again on the next poll
+		if _, ok := pending.All()[pendingAddPrefix+test.item.UID]; ok == test.seen {
+			t.Errorf("Test %v Failed: pending %v, expected %v", idx, ok, !test.seen)
+		}
+	}
+}
+
+// openPending opens the pending torrents of a temporary state database
+func openPending(t *testing.T) (*helper.BoltPending, func()) {
+
+	dir, err := ioutil.TempDir("", "transmission-rss")
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	db, err := helper.OpenBoltDB(filepath.Join(dir, "state.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	return db.Pending(), func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
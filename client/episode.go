@@ -0,0 +1,31 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/whatust/transmission-rss/release"
+)
+
+// normalizeSeries lowercases the series name so that the names used by
+// different release groups compare equal
+func normalizeSeries(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// episodeKey identifies the episode of a release in the history regardless of
+// the release group, batches and titles without series or episode have none
+func episodeKey(r release.Release) (string, bool) {
+
+	series := normalizeSeries(r.Show)
+
+	if len(series) == 0 || r.Episode == 0 || r.Batch || r.EpisodeEnd != r.Episode {
+		return "", false
+	}
+
+	if r.Absolute {
+		return fmt.Sprintf("%v E%02d", series, r.Episode), true
+	}
+
+	return fmt.Sprintf("%v S%02dE%02d", series, r.Season, r.Episode), true
+}
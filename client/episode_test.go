@@ -0,0 +1,114 @@
+package client
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/whatust/transmission-rss/config"
+	"github.com/whatust/transmission-rss/helper"
+	"github.com/whatust/transmission-rss/release"
+)
+
+func TestEpisodeKey(t *testing.T) {
+
+	var tests = []struct {
+		title    string
+		expected string
+		ok       bool
+	}{
+		{"Show.Name.S01E05.1080p", "show name S01E05", true},
+		{"[Other] Show Name S01E05 720p", "show name S01E05", true},
+		{"Show_Name 1x05 HDTV", "show name S01E05", true},
+		{"[Group] Show Name - 05", "show name E05", true},
+		{"[Group] SHOW NAME - 05v2", "show name E05", true},
+		{"Show Name E1024 1080p", "show name E1024", true},
+		{"Show Name S00E05", "show name S00E05", true},
+		{"Show Name 1080p WEB", "", false},
+		{"[Group] Show Name (Batch) [1080p]", "", false},
+		{"[Group] Show Name - 01-12 [1080p]", "", false},
+		{"Show.Name.S01E01E02.720p", "", false},
+		{"Show.Name.S02.1080p", "", false},
+		{"S01E01", "", false},
+	}
+
+	for idx, test := range tests {
+
+		key, ok := episodeKey(release.Parse(test.title))
+
+		if ok != test.ok || key != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v %v\nExpected: %v %v", idx, key, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestProcessItemEpisodes(t *testing.T) {
+
+	var tests = []struct {
+		upgrades []string
+		titles   []string
+		expected []string
+	}{
+		{
+			nil,
+			[]string{"[Group] Show - 01 [1080p]", "[Other] Show - 01 [720p]", "[Group] Show - 02 [1080p]"},
+			[]string{"[Group] Show - 01 [1080p]", "[Group] Show - 02 [1080p]"},
+		},
+		{
+			nil,
+			[]string{"[Group] Show - 01 [1080p]", "[Group] Show - 01v2 [1080p]"},
+			[]string{"[Group] Show - 01 [1080p]"},
+		},
+		{
+			[]string{"version"},
+			[]string{"[Group] Show - 01 [1080p]", "[Group] Show - 01v2 [1080p]", "[Other] Show - 01 [1080p]"},
+			[]string{"[Group] Show - 01 [1080p]", "[Group] Show - 01v2 [1080p]"},
+		},
+	}
+
+	for idx, test := range tests {
+
+		client := TransmissionClient{
+			History: &helper.HistoryMap{
+				Entries: make(map[string]helper.HistoryEntry),
+			},
+		}
+
+		filter := &Filter{
+			RegExp:       regexp.MustCompile("Show"),
+			DownloadPath: "/downloads",
+			Episodes:     true,
+			Upgrades:     test.upgrades,
+		}
+
+		seen := helper.SeenSet{
+			Old: make(map[string]helper.SeenEntry),
+			New: make(map[string]helper.SeenEntry),
+		}
+
+		channel := make(chan TorrentReq, len(test.titles))
+
+		// Items are processed in order so the first release wins
+		for _, title := range test.titles {
+			wg.Add(1)
+			client.processItem(FeedItem{Title: title, Link: "http://example.com/" + title}, config.Feed{URL: "http://feed.com"}, "Show", filter, channel, &seen)
+		}
+		close(channel)
+
+		var received []string
+		for req := range channel {
+			received = append(received, req.Title)
+			client.History.Commit(req.EpisodeKey, req.EpisodeEntry)
+		}
+
+		if len(received) != len(test.expected) {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, received, test.expected)
+			continue
+		}
+		for i := range received {
+			if received[i] != test.expected[i] {
+				t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, received, test.expected)
+				break
+			}
+		}
+	}
+}
@@ -1,38 +1,366 @@
 package client
 
 import (
+	"bytes"
 	"encoding/xml"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/whatust/transmission-rss/config"
 	"github.com/whatust/transmission-rss/logger"
 )
 
-// FeedItem structure that wraps the torrent data
+// FeedItem structure that wraps the torrent data, counts are -1 when the
+// feed does not provide them
 type FeedItem struct {
-	Title   string `xml:"title"`
-	Link    string `xml:"link"`
-	Remake  string `xml:"remake"`
-	Trusted string `xml:"trusted"`
+	Title      string    `xml:"title"`
+	Link       string    `xml:"link"`
+	Remake     string    `xml:"remake"`
+	Trusted    string    `xml:"trusted"`
+	InfoHash   string    `xml:"infoHash"`
+	GUID       string    `xml:"guid"`
+	Published  time.Time `xml:"pubDate"`
+	Enclosure  Enclosure `xml:"enclosure"`
+	Size       int64     `xml:"size"`
+	Seeders    int       `xml:"seeders"`
+	Leechers   int       `xml:"leechers"`
+	Downloads  int       `xml:"downloads"`
+	Categories []string  `xml:"category"`
+	CategoryID string    `xml:"categoryId"`
+	MagnetURL  string    `xml:"magnetUrl"`
+	Freeleech  bool      `xml:"freeleech"`
+	// Torznab and Newznab attributes by lowercase name
+	Attributes map[string]string `xml:"-"`
+}
+
+// torznabAttr attribute element of Torznab and Newznab feeds
+type torznabAttr struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// rssItem item element of a RSS feed as sent by the trackers
+type rssItem struct {
+	Title      string    `xml:"title"`
+	Link       string    `xml:"link"`
+	Remake     string    `xml:"remake"`
+	Trusted    string    `xml:"trusted"`
+	InfoHash   string    `xml:"infoHash"`
+	GUID       string    `xml:"guid"`
+	PubDate    string    `xml:"pubDate"`
+	Enclosure  Enclosure `xml:"enclosure"`
+	Size       string    `xml:"size"`
+	Seeders    string    `xml:"seeders"`
+	Leechers   string    `xml:"leechers"`
+	Downloads  string    `xml:"downloads"`
+	Categories []string  `xml:"category"`
+	CategoryID string    `xml:"categoryId"`
+	// Matches both torznab:attr and newznab:attr
+	Attrs []torznabAttr `xml:"attr"`
+}
+
+// UnmarshalXML parses a RSS item converting its fields to typed values
+func (item *FeedItem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+
+	var raw rssItem
+
+	err := d.DecodeElement(&raw, &start)
+	if err != nil {
+		return err
+	}
+
+	*item = FeedItem{
+		Title:      strings.TrimSpace(raw.Title),
+		Link:       strings.TrimSpace(raw.Link),
+		Remake:     raw.Remake,
+		Trusted:    raw.Trusted,
+		InfoHash:   strings.TrimSpace(raw.InfoHash),
+		GUID:       strings.TrimSpace(raw.GUID),
+		Published:  parseDate(raw.PubDate),
+		Enclosure:  raw.Enclosure,
+		Size:       raw.Enclosure.Length,
+		Seeders:    parseCount(raw.Seeders),
+		Leechers:   parseCount(raw.Leechers),
+		Downloads:  parseCount(raw.Downloads),
+		Categories: raw.Categories,
+		CategoryID: raw.CategoryID,
+	}
+
+	if len(raw.Size) != 0 {
+		size, err := config.ParseSize(raw.Size)
+		if err != nil {
+			logger.Warn("Could not parse size of %v: %v\n", item.Title, err)
+		} else {
+			item.Size = size
+		}
+	}
+
+	item.applyAttributes(raw.Attrs)
+
+	return nil
+}
+
+// applyAttributes maps the Torznab attributes to the item fields, the
+// attributes take precedence over the RSS elements
+func (item *FeedItem) applyAttributes(attrs []torznabAttr) {
+
+	if len(attrs) == 0 {
+		return
+	}
+
+	item.Attributes = make(map[string]string)
+
+	var peers int = -1
+
+	for _, attr := range attrs {
+
+		name := strings.ToLower(attr.Name)
+		value := strings.TrimSpace(attr.Value)
+
+		switch name {
+		case "seeders":
+			item.Seeders = parseCount(value)
+		case "leechers":
+			item.Leechers = parseCount(value)
+		case "peers":
+			peers = parseCount(value)
+		case "grabs":
+			item.Downloads = parseCount(value)
+		case "size":
+			size, err := config.ParseSize(value)
+			if err != nil {
+				logger.Warn("Could not parse size of %v: %v\n", item.Title, err)
+			} else {
+				item.Size = size
+			}
+		case "infohash":
+			item.InfoHash = value
+		case "magneturl":
+			item.MagnetURL = value
+		case "category":
+			if !containString(item.Categories, value) {
+				item.Categories = append(item.Categories, value)
+			}
+		case "downloadvolumefactor":
+			factor, err := strconv.ParseFloat(value, 64)
+			item.Freeleech = err == nil && factor == 0
+		}
+
+		// Repeated attributes such as category are joined
+		if old, ok := item.Attributes[name]; ok {
+			value = old + "," + value
+		}
+		item.Attributes[name] = value
+	}
+
+	// Torznab peers count seeders and leechers
+	if peers >= 0 && item.Leechers < 0 && item.Seeders >= 0 {
+		item.Leechers = peers - item.Seeders
+	}
+}
+
+func containString(list []string, value string) bool {
+
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dateLayouts formats used by feeds for the publication date
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339,
+}
+
+// parseDate parses a feed date returning the zero time when unknown
+func parseDate(value string) time.Time {
+
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return time.Time{}
+	}
+
+	for _, layout := range dateLayouts {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date
+		}
+	}
+
+	logger.Warn("Could not parse date: %v\n", value)
+	return time.Time{}
+}
+
+// parseCount parses a feed counter returning -1 when unknown
+func parseCount(value string) int {
+
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return -1
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Warn("Could not parse count: %v\n", value)
+		return -1
+	}
+
+	return count
+}
+
+// Enclosure file attached to a feed item
+type Enclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+// TorrentLink returns the enclosure URL when it holds the torrent otherwise the item link
+func (item FeedItem) TorrentLink() string {
+
+	switch item.Enclosure.Type {
+	case "", "application/x-bittorrent":
+		if len(item.Enclosure.URL) != 0 {
+			return item.Enclosure.URL
+		}
+	}
+
+	return item.Link
 }
 
 // Channel ...
 type Channel struct {
 	Items []FeedItem `xml:"item"`
+	TTL   int        `xml:"ttl"`
 }
 
 // Feed structure that wraps the list of torrents
 type Feed struct {
 	Channel Channel `xml:"channel"`
+	// Set when the server answered 304 to a conditional request
+	NotModified bool `xml:"-"`
+}
+
+// atomLink link element of an Atom entry
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+// atomEntry entry element of an Atom feed
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Links     []atomLink `xml:"link"`
+}
+
+// atomFeed root element of an Atom feed
+type atomFeed struct {
+	Entries []atomEntry `xml:"entry"`
 }
 
-// ParseXML ...
+// feedItem converts the Atom entry to the item model used for RSS
+func (entry atomEntry) feedItem() FeedItem {
+
+	item := FeedItem{
+		Title:     strings.TrimSpace(entry.Title),
+		GUID:      strings.TrimSpace(entry.ID),
+		Seeders:   -1,
+		Leechers:  -1,
+		Downloads: -1,
+	}
+
+	for _, link := range entry.Links {
+		switch link.Rel {
+		case "enclosure":
+			item.Enclosure = Enclosure{
+				URL:    link.Href,
+				Type:   link.Type,
+				Length: link.Length,
+			}
+			item.Size = link.Length
+		case "", "alternate":
+			if len(item.Link) == 0 {
+				item.Link = link.Href
+			}
+		}
+	}
+
+	updated := entry.Updated
+	if len(updated) == 0 {
+		updated = entry.Published
+	}
+
+	if len(updated) != 0 {
+		published, err := time.Parse(time.RFC3339, updated)
+		if err != nil {
+			logger.Warn("Could not parse entry date %v: %v\n", updated, err)
+		} else {
+			item.Published = published
+		}
+	}
+
+	return item
+}
+
+// rootElement returns the local name of the document root element
+func rootElement(body []byte) (string, error) {
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// ParseXML parses a RSS 2.0 or Atom document into a feed
 func ParseXML(body []byte) *Feed {
 
 	var feed Feed
 
-	err := xml.Unmarshal([]byte(body), &feed)
+	root, err := rootElement(body)
+	if err != nil {
+		logger.Error("%v", err)
+		return nil
+	}
+
+	switch root {
+	case "rss":
+		err = xml.Unmarshal(body, &feed)
+	case "feed":
+		var atom atomFeed
+		err = xml.Unmarshal(body, &atom)
+		for _, entry := range atom.Entries {
+			feed.Channel.Items = append(feed.Channel.Items, entry.feedItem())
+		}
+	default:
+		err = fmt.Errorf("Unknown feed format, root element: %v", root)
+	}
+
 	if err != nil {
 		logger.Error("%v", err)
 		return nil
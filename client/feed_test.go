@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestParseXML(t *testing.T) {
@@ -21,34 +22,136 @@ func TestParseXML(t *testing.T) {
 				Channel: Channel{
 					Items: []FeedItem{
 						{
-							Title:   "title1",
-							Link:    "http://example1.com",
-							Remake:  "Yes",
-							Trusted: "Yes",
+							Title:      "title1",
+							Link:       "http://example1.com",
+							Remake:     "Yes",
+							Trusted:    "Yes",
+							InfoHash:   "1234567890101112131415161718192021222324",
+							Published:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+							Size:       104857600,
+							Seeders:    0,
+							Leechers:   0,
+							Downloads:  0,
+							Categories: []string{"category"},
+							CategoryID: "1",
 						},
 						{
-							Title:   "title2",
-							Link:    "http://example2.com",
-							Remake:  "Yes",
-							Trusted: "No",
+							Title:      "title2",
+							Link:       "http://example2.com",
+							Remake:     "Yes",
+							Trusted:    "No",
+							InfoHash:   "1234567890101112131415161718192021222324",
+							Published:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+							Size:       104857600,
+							Seeders:    0,
+							Leechers:   0,
+							Downloads:  0,
+							Categories: []string{"category"},
+							CategoryID: "1",
 						},
 						{
-							Title:   "title3",
-							Link:    "http://example3.com",
-							Remake:  "No",
-							Trusted: "No",
+							Title:      "title3",
+							Link:       "http://example3.com",
+							Remake:     "No",
+							Trusted:    "No",
+							InfoHash:   "1234567890101112131415161718192021222324",
+							Published:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+							Size:       104857600,
+							Seeders:    0,
+							Leechers:   0,
+							Downloads:  0,
+							Categories: []string{"category"},
+							CategoryID: "1",
 						},
 						{
-							Title:   "title4",
-							Link:    "http://example4.com",
-							Remake:  "No",
-							Trusted: "Yes",
+							Title:      "title4",
+							Link:       "http://example4.com",
+							Remake:     "No",
+							Trusted:    "Yes",
+							InfoHash:   "1234567890101112131415161718192021222324",
+							Published:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+							Size:       104857600,
+							Seeders:    0,
+							Leechers:   0,
+							Downloads:  0,
+							Categories: []string{"category"},
+							CategoryID: "1",
 						},
 					},
 				},
 			},
 		},
 		{"../test/feed/feed2.xml", nil },
+		{"../test/feed/atom.xml",
+			&Feed{
+				Channel: Channel{
+					Items: []FeedItem{
+						{
+							Title:     "title1",
+							Link:      "http://example1.com",
+							GUID:      "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a",
+							Published: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+							Enclosure: Enclosure{
+								URL:    "http://example1.com/title1.torrent",
+								Type:   "application/x-bittorrent",
+								Length: 1024,
+							},
+							Size:      1024,
+							Seeders:   -1,
+							Leechers:  -1,
+							Downloads: -1,
+						},
+						{
+							Title:     "title2",
+							Link:      "http://example2.com/title2.torrent",
+							GUID:      "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6b",
+							Published: time.Date(2000, 1, 2, 12, 0, 0, 0, time.FixedZone("", 3600)),
+							Seeders:   -1,
+							Leechers:  -1,
+							Downloads: -1,
+						},
+					},
+				},
+			},
+		},
+		{"../test/feed/html.xml", nil },
+		{"../test/feed/torznab.xml",
+			&Feed{
+				Channel: Channel{
+					Items: []FeedItem{
+						{
+							Title:     "title1",
+							Link:      "http://indexer.com/download/1",
+							GUID:      "http://indexer.com/details/1",
+							Published: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+							Enclosure: Enclosure{
+								URL:    "http://indexer.com/download/1",
+								Type:   "application/x-bittorrent",
+								Length: 1024,
+							},
+							InfoHash:   "1234567890abcdef1234567890abcdef12345678",
+							MagnetURL:  "magnet:?xt=urn:btih:1234567890abcdef1234567890abcdef12345678",
+							Size:       2048,
+							Seeders:    10,
+							Leechers:   5,
+							Downloads:  -1,
+							Categories: []string{"5000", "5040"},
+							Freeleech:  true,
+							Attributes: map[string]string{
+								"category":             "5000,5040",
+								"seeders":              "10",
+								"peers":                "15",
+								"size":                 "2048",
+								"infohash":             "1234567890abcdef1234567890abcdef12345678",
+								"magneturl":            "magnet:?xt=urn:btih:1234567890abcdef1234567890abcdef12345678",
+								"downloadvolumefactor": "0",
+								"uploadvolumefactor":   "1",
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for idx, test := range tests {
@@ -60,7 +163,7 @@ func TestParseXML(t *testing.T) {
 
 		feed := ParseXML([]byte(data))
 
-		if !reflect.DeepEqual(feed, test.expected) {
+		if !feedEqual(feed, test.expected) {
 			t.Errorf("Test %v Failed: Feed do not match \nGot      %v, \nExpected %v", idx, feed, test.expected)
 		}
 	}
@@ -78,28 +181,60 @@ func TestParseResponseXML(t *testing.T) {
 				Channel: Channel{
 					Items: []FeedItem{
 						{
-							Title:   "title1",
-							Link:    "http://example1.com",
-							Remake:  "Yes",
-							Trusted: "Yes",
+							Title:      "title1",
+							Link:       "http://example1.com",
+							Remake:     "Yes",
+							Trusted:    "Yes",
+							InfoHash:   "1234567890101112131415161718192021222324",
+							Published:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+							Size:       104857600,
+							Seeders:    0,
+							Leechers:   0,
+							Downloads:  0,
+							Categories: []string{"category"},
+							CategoryID: "1",
 						},
 						{
-							Title:   "title2",
-							Link:    "http://example2.com",
-							Remake:  "Yes",
-							Trusted: "No",
+							Title:      "title2",
+							Link:       "http://example2.com",
+							Remake:     "Yes",
+							Trusted:    "No",
+							InfoHash:   "1234567890101112131415161718192021222324",
+							Published:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+							Size:       104857600,
+							Seeders:    0,
+							Leechers:   0,
+							Downloads:  0,
+							Categories: []string{"category"},
+							CategoryID: "1",
 						},
 						{
-							Title:   "title3",
-							Link:    "http://example3.com",
-							Remake:  "No",
-							Trusted: "No",
+							Title:      "title3",
+							Link:       "http://example3.com",
+							Remake:     "No",
+							Trusted:    "No",
+							InfoHash:   "1234567890101112131415161718192021222324",
+							Published:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+							Size:       104857600,
+							Seeders:    0,
+							Leechers:   0,
+							Downloads:  0,
+							Categories: []string{"category"},
+							CategoryID: "1",
 						},
 						{
-							Title:   "title4",
-							Link:    "http://example4.com",
-							Remake:  "No",
-							Trusted: "Yes",
+							Title:      "title4",
+							Link:       "http://example4.com",
+							Remake:     "No",
+							Trusted:    "Yes",
+							InfoHash:   "1234567890101112131415161718192021222324",
+							Published:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+							Size:       104857600,
+							Seeders:    0,
+							Leechers:   0,
+							Downloads:  0,
+							Categories: []string{"category"},
+							CategoryID: "1",
 						},
 					},
 				},
@@ -130,8 +265,74 @@ func TestParseResponseXML(t *testing.T) {
 
 		feed := ParseResponseXML(resp, 0)
 
-		if !reflect.DeepEqual(feed, test.expected) {
+		if !feedEqual(feed, test.expected) {
 			t.Errorf("Test %v Failed: Feed do not match \nGot      %v, \nExpected %v", idx, feed, test.expected)
 		}
 	}
 }
+
+// feedEqual compares feeds using time.Equal for the item dates
+func feedEqual(a *Feed, b *Feed) bool {
+
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if len(a.Channel.Items) != len(b.Channel.Items) {
+		return false
+	}
+
+	for i := range a.Channel.Items {
+
+		itemA, itemB := a.Channel.Items[i], b.Channel.Items[i]
+		if !itemA.Published.Equal(itemB.Published) {
+			return false
+		}
+
+		itemA.Published, itemB.Published = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(itemA, itemB) {
+			return false
+		}
+	}
+
+	return a.Channel.TTL == b.Channel.TTL
+}
+
+func TestTorrentLink(t *testing.T) {
+
+	var tests = []struct {
+		item     FeedItem
+		expected string
+	}{
+		{FeedItem{Link: "http://example.com"}, "http://example.com"},
+		{FeedItem{Link: "http://example.com", Enclosure: Enclosure{URL: "http://example.com/file.torrent"}}, "http://example.com/file.torrent"},
+		{FeedItem{Link: "http://example.com", Enclosure: Enclosure{URL: "http://example.com/file.torrent", Type: "application/x-bittorrent"}}, "http://example.com/file.torrent"},
+		{FeedItem{Link: "http://example.com", Enclosure: Enclosure{URL: "http://example.com/file.mp3", Type: "audio/mpeg"}}, "http://example.com"},
+	}
+
+	for idx, test := range tests {
+		if link := test.item.TorrentLink(); link != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, link, test.expected)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+
+	var tests = []struct {
+		value    string
+		expected time.Time
+	}{
+		{"Mon, 01 Jan 2000 00:00:00 -0000", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"Sat, 1 Jan 2000 10:00:00 +0200", time.Date(2000, 1, 1, 8, 0, 0, 0, time.UTC)},
+		{"2000-01-01T00:00:00Z", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"yesterday", time.Time{}},
+		{"", time.Time{}},
+	}
+
+	for idx, test := range tests {
+		if date := parseDate(test.value); !date.Equal(test.expected) {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, date, test.expected)
+		}
+	}
+}
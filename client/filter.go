@@ -3,32 +3,132 @@ package client
 import (
 	"fmt"
 	"regexp"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/whatust/transmission-rss/config"
 	"github.com/whatust/transmission-rss/logger"
+	"github.com/whatust/transmission-rss/release"
 )
 
 // Filter ...
 type Filter struct {
 	RegExp       *regexp.Regexp
 	DownloadPath string
+	PathTemplate *template.Template
 	IgnoreRemake bool
 	OnlyTrusted  bool
+	AddOptions   config.AddOptions
+	// Torznab filters
+	OnlyFreeleech bool
+	Attributes    map[string]*regexp.Regexp
+	// Extra regexps the title must all match and must not match
+	Include []*regexp.Regexp
+	Exclude []*regexp.Regexp
+	// Item metadata filters, zero values disable them
+	MinSize    int64
+	MaxSize    int64
+	MinSeeders int
+	MaxAge     time.Duration
+	Categories []string
+	// Fields parsed from the release title
+	Release map[string]*regexp.Regexp
+	// Episode tracking, allowed upgrades and quality preference
+	Episodes  bool
+	Upgrades  []string
+	Qualities []string
+	Cutoff    string
+	Wait      time.Duration
+}
+
+// compileAll compiles the list of regexps
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+
+	var res []*regexp.Regexp
+
+	for _, expr := range exprs {
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+
+	return res, nil
 }
 
 // CreateFilter creates filter to match torrent
 func CreateFilter(matcher config.Matcher) (*Filter, error) {
 
+	re, err := regexp.Compile(matcher.RegExp)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid regexp: %v", err)
+	}
+
 	filter := Filter{
-		RegExp:       regexp.MustCompile(matcher.RegExp),
-		DownloadPath: matcher.DownloadPath,
-		IgnoreRemake: matcher.IgnoreRemake,
-		OnlyTrusted:  matcher.OnlyTrusted,
+		RegExp:        re,
+		DownloadPath:  matcher.DownloadPath,
+		IgnoreRemake:  matcher.IgnoreRemake != nil && *matcher.IgnoreRemake,
+		OnlyTrusted:   matcher.OnlyTrusted != nil && *matcher.OnlyTrusted,
+		AddOptions:    matcher.AddOptions,
+		OnlyFreeleech: matcher.OnlyFreeleech,
+		MinSize:       int64(matcher.MinSize),
+		MaxSize:       int64(matcher.MaxSize),
+		MinSeeders:    matcher.MinSeeders,
+		MaxAge:        time.Duration(matcher.MaxAge),
+		Categories:    matcher.Categories,
+		Episodes:      matcher.Episodes,
+		Upgrades:      matcher.Upgrades,
+		Qualities:     matcher.Qualities,
+		Cutoff:        matcher.Cutoff,
+		Wait:          time.Duration(matcher.Wait),
+	}
+
+	for name, expr := range matcher.Attributes {
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regexp for attribute %v: %v", name, err)
+		}
+
+		if filter.Attributes == nil {
+			filter.Attributes = make(map[string]*regexp.Regexp)
+		}
+		filter.Attributes[strings.ToLower(name)] = re
+	}
+
+	for name, expr := range matcher.Release {
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regexp for release field %v: %v", name, err)
+		}
+
+		if filter.Release == nil {
+			filter.Release = make(map[string]*regexp.Regexp)
+		}
+		filter.Release[name] = re
+	}
+
+	filter.Include, err = compileAll(matcher.Include)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid include regexp: %v", err)
+	}
+
+	filter.Exclude, err = compileAll(matcher.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid exclude regexp: %v", err)
+	}
+
+	if isPathTemplate(filter.DownloadPath) {
+		filter.PathTemplate, err = parsePathTemplate(filter.DownloadPath)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid download path template: %v", err)
+		}
 	}
 
-	/*if len(filter.DownloadPath) == 0 {
-		filter.DownloadPath = conf.DefaultDownloadPath
-	}*/
 	if len(filter.DownloadPath) == 0 {
 		return nil, fmt.Errorf("Download path must be set")
 	}
@@ -49,6 +149,49 @@ func FilterTorrent(torrent FeedItem, filter *Filter) bool {
 		return false
 	}
 
+	if filter.OnlyFreeleech && !torrent.Freeleech {
+		logger.Debug("Ignoring non freeleech torrent: %v\n", torrent.Title)
+		return false
+	}
+
+	for name, re := range filter.Attributes {
+
+		value, ok := torrent.Attributes[name]
+		if !ok || !re.MatchString(value) {
+			logger.Debug(
+				"Attribute does not match regex:\nAttribute:%v\nRegex:%v\nTitle:%v\n",
+				name,
+				re,
+				torrent.Title,
+			)
+			return false
+		}
+	}
+
+	if !filterMetadata(torrent, filter) {
+		return false
+	}
+
+	if len(filter.Release) != 0 {
+
+		fields := release.Parse(torrent.Title).Fields()
+
+		for name, re := range filter.Release {
+
+			value, ok := fields[name]
+			if !ok || !re.MatchString(value) {
+				logger.Debug(
+					"Release field does not match regex:\nField:%v\nValue:%v\nRegex:%v\nTitle:%v\n",
+					name,
+					value,
+					re,
+					torrent.Title,
+				)
+				return false
+			}
+		}
+	}
+
 	matched := filter.RegExp.Match([]byte(torrent.Title))
 
 	if !matched {
@@ -60,5 +203,81 @@ func FilterTorrent(torrent FeedItem, filter *Filter) bool {
 		return false
 	}
 
+	for _, re := range filter.Include {
+		if !re.MatchString(torrent.Title) {
+			logger.Debug(
+				"Title does not match include regex:\nRegex:%v\nTitle:%v\n",
+				re,
+				torrent.Title,
+			)
+			return false
+		}
+	}
+
+	for _, re := range filter.Exclude {
+		if re.MatchString(torrent.Title) {
+			logger.Debug(
+				"Title rejected by exclude regex:\nRegex:%v\nTitle:%v\n",
+				re,
+				torrent.Title,
+			)
+			return false
+		}
+	}
+
 	return true
 }
+
+// filterMetadata checks size, seeders, age and category of the item, values
+// the feed does not provide pass the filters
+func filterMetadata(torrent FeedItem, filter *Filter) bool {
+
+	if torrent.Size > 0 {
+		if filter.MinSize > 0 && torrent.Size < filter.MinSize {
+			logger.Debug("Ignoring torrent smaller than %v bytes: %v (%v)\n", filter.MinSize, torrent.Title, torrent.Size)
+			return false
+		}
+		if filter.MaxSize > 0 && torrent.Size > filter.MaxSize {
+			logger.Debug("Ignoring torrent larger than %v bytes: %v (%v)\n", filter.MaxSize, torrent.Title, torrent.Size)
+			return false
+		}
+	}
+
+	if filter.MinSeeders > 0 && torrent.Seeders >= 0 && torrent.Seeders < filter.MinSeeders {
+		logger.Debug("Ignoring torrent with less than %v seeders: %v (%v)\n", filter.MinSeeders, torrent.Title, torrent.Seeders)
+		return false
+	}
+
+	if filter.MaxAge > 0 && !torrent.Published.IsZero() {
+		if age := time.Since(torrent.Published); age > filter.MaxAge {
+			logger.Debug("Ignoring torrent older than %v: %v (%v)\n", filter.MaxAge, torrent.Title, age)
+			return false
+		}
+	}
+
+	if len(filter.Categories) != 0 && !matchCategory(torrent, filter.Categories) {
+		logger.Debug("Ignoring torrent outside categories %v: %v (%v)\n", filter.Categories, torrent.Title, torrent.Categories)
+		return false
+	}
+
+	return true
+}
+
+// matchCategory returns true when one of the item categories is in the list
+func matchCategory(torrent FeedItem, categories []string) bool {
+
+	for _, category := range categories {
+
+		if len(torrent.CategoryID) != 0 && category == torrent.CategoryID {
+			return true
+		}
+
+		for _, itemCategory := range torrent.Categories {
+			if strings.EqualFold(category, itemCategory) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
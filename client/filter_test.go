@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/whatust/transmission-rss/config"
 )
@@ -81,6 +82,211 @@ func TestFilterTorrent(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			item: FeedItem{
+				Title:     "Item1",
+				Freeleech: false,
+			},
+			filter: &Filter{
+				RegExp:        regexp.MustCompile("Item"),
+				OnlyFreeleech: true,
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title:      "Item1",
+				Freeleech:  true,
+				Attributes: map[string]string{"category": "5000,5040"},
+			},
+			filter: &Filter{
+				RegExp:        regexp.MustCompile("Item"),
+				OnlyFreeleech: true,
+				Attributes: map[string]*regexp.Regexp{
+					"category": regexp.MustCompile(`\b5040\b`),
+				},
+			},
+			expected: true,
+		},
+		{
+			item: FeedItem{
+				Title:      "Item1",
+				Attributes: map[string]string{"category": "5000"},
+			},
+			filter: &Filter{
+				RegExp: regexp.MustCompile("Item"),
+				Attributes: map[string]*regexp.Regexp{
+					"category": regexp.MustCompile(`\b5040\b`),
+				},
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title: "Item1",
+			},
+			filter: &Filter{
+				RegExp: regexp.MustCompile("Item"),
+				Attributes: map[string]*regexp.Regexp{
+					"genre": regexp.MustCompile("drama"),
+				},
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title: "Show Name - 01 [1080p]",
+			},
+			filter: &Filter{
+				RegExp:  regexp.MustCompile("Show Name"),
+				Include: []*regexp.Regexp{regexp.MustCompile("1080p")},
+				Exclude: []*regexp.Regexp{regexp.MustCompile("720p"), regexp.MustCompile("HEVC")},
+			},
+			expected: true,
+		},
+		{
+			item: FeedItem{
+				Title: "Show Name - 01 [1080p HEVC]",
+			},
+			filter: &Filter{
+				RegExp:  regexp.MustCompile("Show Name"),
+				Include: []*regexp.Regexp{regexp.MustCompile("1080p")},
+				Exclude: []*regexp.Regexp{regexp.MustCompile("720p"), regexp.MustCompile("HEVC")},
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title: "Show Name - 01 [480p]",
+			},
+			filter: &Filter{
+				RegExp:  regexp.MustCompile("Show Name"),
+				Include: []*regexp.Regexp{regexp.MustCompile("1080p")},
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title:   "Show Name 1080p",
+				Size:    50 * 1000 * 1000,
+				Seeders: -1,
+			},
+			filter: &Filter{
+				RegExp:  regexp.MustCompile("Show Name"),
+				MinSize: 500 * 1000 * 1000,
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title:   "Show Name 1080p",
+				Size:    5 * 1000 * 1000 * 1000,
+				Seeders: -1,
+			},
+			filter: &Filter{
+				RegExp:  regexp.MustCompile("Show Name"),
+				MinSize: 500 * 1000 * 1000,
+				MaxSize: 4 * 1000 * 1000 * 1000,
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title:   "Show Name 1080p",
+				Seeders: -1,
+			},
+			filter: &Filter{
+				RegExp:     regexp.MustCompile("Show Name"),
+				MinSize:    500 * 1000 * 1000,
+				MinSeeders: 5,
+				MaxAge:     time.Hour,
+			},
+			expected: true,
+		},
+		{
+			item: FeedItem{
+				Title:   "Show Name 1080p",
+				Seeders: 2,
+			},
+			filter: &Filter{
+				RegExp:     regexp.MustCompile("Show Name"),
+				MinSeeders: 5,
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title:     "Show Name 1080p",
+				Published: time.Now().Add(-48 * time.Hour),
+			},
+			filter: &Filter{
+				RegExp: regexp.MustCompile("Show Name"),
+				MaxAge: 24 * time.Hour,
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title:      "Show Name 1080p",
+				Categories: []string{"Anime - English-translated"},
+				CategoryID: "1_2",
+			},
+			filter: &Filter{
+				RegExp:     regexp.MustCompile("Show Name"),
+				Categories: []string{"anime - english-translated"},
+			},
+			expected: true,
+		},
+		{
+			item: FeedItem{
+				Title:      "Show Name 1080p",
+				Categories: []string{"Anime - Raw"},
+				CategoryID: "1_4",
+			},
+			filter: &Filter{
+				RegExp:     regexp.MustCompile("Show Name"),
+				Categories: []string{"1_2", "Anime - English-translated"},
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title: "[Group] Show Name - 05 [1080p][HEVC]",
+			},
+			filter: &Filter{
+				RegExp: regexp.MustCompile("Show Name"),
+				Release: map[string]*regexp.Regexp{
+					"group":      regexp.MustCompile("^Group$"),
+					"resolution": regexp.MustCompile("1080p|720p"),
+					"codec":      regexp.MustCompile("H.265"),
+				},
+			},
+			expected: true,
+		},
+		{
+			item: FeedItem{
+				Title: "[Group] Show Name - 05 [480p]",
+			},
+			filter: &Filter{
+				RegExp: regexp.MustCompile("Show Name"),
+				Release: map[string]*regexp.Regexp{
+					"resolution": regexp.MustCompile("1080p|720p"),
+				},
+			},
+			expected: false,
+		},
+		{
+			item: FeedItem{
+				Title: "[Group] Show Name - 01-12 [1080p]",
+			},
+			filter: &Filter{
+				RegExp: regexp.MustCompile("Show Name"),
+				Release: map[string]*regexp.Regexp{
+					"batch": regexp.MustCompile("false"),
+				},
+			},
+			expected: false,
+		},
 	}
 
 	for idx, test := range tests {
@@ -102,8 +308,6 @@ func TestCreateFilter(t *testing.T) {
 			config.Matcher{
 				RegExp: "example",
 				DownloadPath: "/var/lib/transmission-daemon/downloads",
-				IgnoreRemake: false,
-				OnlyTrusted: false,
 			},
 			&Filter{
 				RegExp: regexp.MustCompile("example"),
@@ -117,12 +321,88 @@ func TestCreateFilter(t *testing.T) {
 			config.Matcher{
 				RegExp: "example",
 				DownloadPath: "",
-				IgnoreRemake: false,
-				OnlyTrusted: false,
 			},
 			nil,
 			fmt.Errorf("Download path  must be set"),
 		},
+		{
+			config.Matcher{
+				RegExp:        "example",
+				DownloadPath:  "/var/lib/transmission-daemon/downloads",
+				OnlyFreeleech: true,
+				Attributes:    map[string]string{"Genre": "drama"},
+			},
+			&Filter{
+				RegExp:        regexp.MustCompile("example"),
+				DownloadPath:  "/var/lib/transmission-daemon/downloads",
+				OnlyFreeleech: true,
+				Attributes:    map[string]*regexp.Regexp{"genre": regexp.MustCompile("drama")},
+			},
+			nil,
+		},
+		{
+			config.Matcher{
+				RegExp:       "example",
+				DownloadPath: "/var/lib/transmission-daemon/downloads",
+				Attributes:   map[string]string{"genre": "drama("},
+			},
+			nil,
+			fmt.Errorf("Invalid regexp for attribute genre"),
+		},
+		{
+			config.Matcher{
+				RegExp:       "example",
+				DownloadPath: "/var/lib/transmission-daemon/downloads",
+				Release:      map[string]string{"resolution": "1080p"},
+			},
+			&Filter{
+				RegExp:       regexp.MustCompile("example"),
+				DownloadPath: "/var/lib/transmission-daemon/downloads",
+				Release:      map[string]*regexp.Regexp{"resolution": regexp.MustCompile("1080p")},
+			},
+			nil,
+		},
+		{
+			config.Matcher{
+				RegExp:       "example",
+				DownloadPath: "/var/lib/transmission-daemon/downloads",
+				Release:      map[string]string{"group": "sub("},
+			},
+			nil,
+			fmt.Errorf("Invalid regexp for release field group"),
+		},
+		{
+			config.Matcher{
+				RegExp:       "example",
+				DownloadPath: "/var/lib/transmission-daemon/downloads",
+				Include:      []string{"1080p"},
+				Exclude:      []string{"720p", "HEVC"},
+			},
+			&Filter{
+				RegExp:       regexp.MustCompile("example"),
+				DownloadPath: "/var/lib/transmission-daemon/downloads",
+				Include:      []*regexp.Regexp{regexp.MustCompile("1080p")},
+				Exclude:      []*regexp.Regexp{regexp.MustCompile("720p"), regexp.MustCompile("HEVC")},
+			},
+			nil,
+		},
+		{
+			config.Matcher{
+				RegExp:       "example",
+				DownloadPath: "/var/lib/transmission-daemon/downloads",
+				Exclude:      []string{"720p("},
+			},
+			nil,
+			fmt.Errorf("Invalid exclude regexp"),
+		},
+		{
+			config.Matcher{
+				RegExp:       "example(",
+				DownloadPath: "/var/lib/transmission-daemon/downloads",
+			},
+			nil,
+			fmt.Errorf("Invalid regexp"),
+		},
 	}
 
 	for idx, test := range tests {
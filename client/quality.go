@@ -0,0 +1,186 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/whatust/transmission-rss/helper"
+)
+
+// rank returns the position of the quality in the matcher preference, lower
+// is better, qualities not in the preference rank last
+func (filter *Filter) rank(quality string) int {
+
+	for i, q := range filter.Qualities {
+		if q == quality {
+			return i
+		}
+	}
+
+	return len(filter.Qualities)
+}
+
+// wanted returns false when the matcher has a preference without the quality
+func (filter *Filter) wanted(quality string) bool {
+	return len(filter.Qualities) == 0 || filter.rank(quality) < len(filter.Qualities)
+}
+
+// upgrade returns the rule deciding whether the release may replace a grabbed
+// one, nil when the matcher allows no upgrades, versions and PROPER releases
+// only replace releases of the same quality and qualities stop at the cutoff
+func (filter *Filter) upgrade(entry helper.HistoryEntry) func(helper.HistoryEntry) bool {
+
+	if len(filter.Upgrades) == 0 {
+		return nil
+	}
+
+	cutoff := 0
+	if len(filter.Cutoff) != 0 {
+		cutoff = filter.rank(filter.Cutoff)
+	}
+
+	return func(grabbed helper.HistoryEntry) bool {
+
+		sameQuality := filter.rank(entry.Quality) == filter.rank(grabbed.Quality)
+
+		for _, upgrade := range filter.Upgrades {
+			switch upgrade {
+			case "version":
+				if sameQuality && entry.Version > grabbed.Version {
+					return true
+				}
+			case "proper":
+				if sameQuality && entry.Proper > grabbed.Proper {
+					return true
+				}
+			case "quality":
+				if filter.rank(entry.Quality) < filter.rank(grabbed.Quality) && filter.rank(grabbed.Quality) > cutoff {
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+}
+
+// candidate release of an episode waiting for the best one to be picked
+type candidate struct {
+	req      TorrentReq
+	filter   *Filter
+	deadline time.Time
+}
+
+// better returns true when the release is preferred to the other by quality,
+// then version and then PROPER tags
+func (c candidate) better(other candidate) bool {
+
+	rank, otherRank := c.filter.rank(c.req.EpisodeEntry.Quality), c.filter.rank(other.req.EpisodeEntry.Quality)
+	if rank != otherRank {
+		return rank < otherRank
+	}
+
+	if c.req.EpisodeEntry.Version != other.req.EpisodeEntry.Version {
+		return c.req.EpisodeEntry.Version > other.req.EpisodeEntry.Version
+	}
+
+	return c.req.EpisodeEntry.Proper > other.req.EpisodeEntry.Proper
+}
+
+// Collector holds the releases of each episode during the wait window of
+// their matcher so the best one is added instead of the first one seen
+type Collector struct {
+	mu         sync.Mutex
+	candidates map[string]candidate
+}
+
+// NewCollector ...
+func NewCollector() *Collector {
+	return &Collector{
+		candidates: make(map[string]candidate),
+	}
+}
+
+// Add keeps the release when it is the best one of its episode, the window
+// starts with the first release seen
+func (collector *Collector) Add(req TorrentReq, filter *Filter, now time.Time) {
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	cand := candidate{
+		req:      req,
+		filter:   filter,
+		deadline: now.Add(filter.Wait),
+	}
+
+	if current, ok := collector.candidates[req.EpisodeKey]; ok {
+		if !cand.better(current) {
+			return
+		}
+		cand.deadline = current.deadline
+	}
+
+	collector.candidates[req.EpisodeKey] = cand
+}
+
+// Take removes and returns the best releases whose window ended, or all of
+// them when all is set
+func (collector *Collector) Take(now time.Time, all bool) []candidate {
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	var due []candidate
+
+	for key, cand := range collector.candidates {
+		if all || !cand.deadline.After(now) {
+			due = append(due, cand)
+			delete(collector.candidates, key)
+		}
+	}
+
+	return due
+}
+
+// Held returns the held releases
+func (collector *Collector) Held() []TorrentReq {
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	held := make([]TorrentReq, 0, len(collector.candidates))
+	for _, cand := range collector.candidates {
+		held = append(held, cand.req)
+	}
+
+	return held
+}
+
+// Holds returns true when a release of the episode is held
+func (collector *Collector) Holds(key string) bool {
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	_, ok := collector.candidates[key]
+
+	return ok
+}
+
+// Next returns the end of the first window, zero when no release is held
+func (collector *Collector) Next() time.Time {
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	var next time.Time
+
+	for _, cand := range collector.candidates {
+		if next.IsZero() || cand.deadline.Before(next) {
+			next = cand.deadline
+		}
+	}
+
+	return next
+}
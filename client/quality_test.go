@@ -0,0 +1,192 @@
+package client
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/whatust/transmission-rss/config"
+	"github.com/whatust/transmission-rss/helper"
+)
+
+func TestUpgrade(t *testing.T) {
+
+	qualities := []string{"1080p", "720p", "480p"}
+
+	var tests = []struct {
+		filter   Filter
+		entry    helper.HistoryEntry
+		grabbed  helper.HistoryEntry
+		expected bool
+	}{
+		{Filter{}, helper.HistoryEntry{Version: 2}, helper.HistoryEntry{Version: 1}, false},
+		{Filter{Upgrades: []string{"version"}}, helper.HistoryEntry{Version: 2}, helper.HistoryEntry{Version: 1}, true},
+		{Filter{Upgrades: []string{"version"}, Qualities: qualities}, helper.HistoryEntry{Version: 2, Quality: "720p"}, helper.HistoryEntry{Version: 1, Quality: "1080p"}, false},
+		{Filter{Upgrades: []string{"version"}}, helper.HistoryEntry{Version: 1, Proper: 1}, helper.HistoryEntry{Version: 1}, false},
+		{Filter{Upgrades: []string{"proper"}}, helper.HistoryEntry{Version: 1, Proper: 1}, helper.HistoryEntry{Version: 1}, true},
+		{Filter{Upgrades: []string{"quality"}, Qualities: qualities}, helper.HistoryEntry{Quality: "1080p"}, helper.HistoryEntry{Quality: "480p"}, true},
+		{Filter{Upgrades: []string{"quality"}, Qualities: qualities}, helper.HistoryEntry{Quality: "480p"}, helper.HistoryEntry{Quality: "720p"}, false},
+		{Filter{Upgrades: []string{"quality"}, Qualities: qualities, Cutoff: "720p"}, helper.HistoryEntry{Quality: "1080p"}, helper.HistoryEntry{Quality: "720p"}, false},
+		{Filter{Upgrades: []string{"quality"}, Qualities: qualities, Cutoff: "720p"}, helper.HistoryEntry{Quality: "720p"}, helper.HistoryEntry{Quality: "480p"}, true},
+	}
+
+	for idx, test := range tests {
+
+		upgrade := test.filter.upgrade(test.entry)
+
+		if got := upgrade != nil && upgrade(test.grabbed); got != test.expected {
+			t.Errorf("Test %v Failed: upgrade %v over %v returned %v, expected %v", idx, test.entry, test.grabbed, got, test.expected)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+
+	filter := &Filter{
+		Qualities: []string{"1080p", "720p", "480p"},
+		Wait:      10 * time.Minute,
+	}
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	releases := []struct {
+		title   string
+		key     string
+		quality string
+		version int
+		seen    time.Time
+	}{
+		{"Show - 01 [480p]", "show E01", "480p", 1, now},
+		{"Show - 01 [1080p]", "show E01", "1080p", 1, now.Add(time.Minute)},
+		{"Show - 01 [720p]", "show E01", "720p", 1, now.Add(2 * time.Minute)},
+		{"Show - 01v2 [1080p]", "show E01", "1080p", 2, now.Add(3 * time.Minute)},
+		{"Show - 02 [720p]", "show E02", "720p", 1, now.Add(5 * time.Minute)},
+	}
+
+	collector := NewCollector()
+
+	for _, release := range releases {
+		collector.Add(TorrentReq{
+			Title:        release.title,
+			EpisodeKey:   release.key,
+			EpisodeEntry: helper.HistoryEntry{Quality: release.quality, Version: release.version},
+		}, filter, release.seen)
+	}
+
+	if next := collector.Next(); !next.Equal(now.Add(10 * time.Minute)) {
+		t.Errorf("Test Failed: next window end %v, expected %v", next, now.Add(10*time.Minute))
+	}
+
+	var tests = []struct {
+		now      time.Time
+		all      bool
+		expected []string
+	}{
+		{now.Add(9 * time.Minute), false, nil},
+		{now.Add(10 * time.Minute), false, []string{"Show - 01v2 [1080p]"}},
+		{now.Add(11 * time.Minute), true, []string{"Show - 02 [720p]"}},
+		{now.Add(20 * time.Minute), true, nil},
+	}
+
+	for idx, test := range tests {
+
+		due := collector.Take(test.now, test.all)
+
+		var titles []string
+		for _, cand := range due {
+			titles = append(titles, cand.req.Title)
+		}
+
+		if len(titles) != len(test.expected) || (len(titles) != 0 && titles[0] != test.expected[0]) {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, titles, test.expected)
+		}
+	}
+}
+
+func TestDropHeld(t *testing.T) {
+
+	filter := &Filter{Wait: 10 * time.Minute}
+
+	cache := &helper.CacheMap{
+		Entries: map[string]helper.CacheEntry{
+			"http://held.com":  {ETag: "held"},
+			"http://other.com": {ETag: "other"},
+		},
+	}
+
+	client := TransmissionClient{Cache: cache, Candidates: NewCollector()}
+
+	if dropped := client.dropHeld(); dropped != 0 {
+		t.Errorf("Test Failed: %v feeds dropped without held releases", dropped)
+	}
+
+	client.Candidates.Add(TorrentReq{Feed: "http://held.com", EpisodeKey: "show E01"}, filter, time.Now())
+	client.Candidates.Add(TorrentReq{Feed: "http://held.com", EpisodeKey: "show E02"}, filter, time.Now())
+
+	if dropped := client.dropHeld(); dropped != 1 {
+		t.Errorf("Test Failed: %v feeds dropped, expected 1", dropped)
+	}
+
+	if _, ok := cache.Get("http://held.com"); ok {
+		t.Errorf("Test Failed: cache of feed with held releases kept")
+	}
+	if _, ok := cache.Get("http://other.com"); !ok {
+		t.Errorf("Test Failed: cache of feed without held releases dropped")
+	}
+}
+
+func TestAddCandidates(t *testing.T) {
+
+	client := TransmissionClient{
+		History: &helper.HistoryMap{
+			Entries: make(map[string]helper.HistoryEntry),
+		},
+		Candidates: NewCollector(),
+		NoWait:     true,
+	}
+
+	filter := &Filter{
+		RegExp:       regexp.MustCompile("Show"),
+		DownloadPath: "/downloads",
+		Episodes:     true,
+		Qualities:    []string{"1080p", "720p"},
+		Upgrades:     []string{"quality"},
+		Cutoff:       "1080p",
+	}
+
+	seen := helper.SeenSet{
+		Old: make(map[string]helper.SeenEntry),
+		New: make(map[string]helper.SeenEntry),
+	}
+
+	var tests = []struct {
+		titles   []string
+		expected []string
+	}{
+		{[]string{"Show - 01 [720p]", "Show - 01 [480p]", "Show - 01 [1080p]"}, []string{"Show - 01 [1080p]"}},
+		{[]string{"Show - 02 [720p]", "Show - 02 [480p]"}, []string{"Show - 02 [720p]"}},
+		{[]string{"Show - 02 [1080p]", "Show - 01 [1080p] REPACK"}, []string{"Show - 02 [1080p]"}},
+	}
+
+	for idx, test := range tests {
+
+		channel := make(chan TorrentReq, len(test.titles))
+
+		for _, title := range test.titles {
+			wg.Add(1)
+			client.processItem(FeedItem{Title: title, Link: "http://example.com/" + title}, config.Feed{URL: "http://feed.com"}, "Show", filter, channel, &seen)
+		}
+		client.addCandidates(channel, time.Now())
+		close(channel)
+
+		var received []string
+		for req := range channel {
+			received = append(received, req.Title)
+			client.History.Commit(req.EpisodeKey, req.EpisodeEntry)
+		}
+
+		if len(received) != len(test.expected) || (len(received) != 0 && received[0] != test.expected[0]) {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, received, test.expected)
+		}
+	}
+}
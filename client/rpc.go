@@ -1,24 +1,33 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/whatust/transmission-rss/config"
 	"github.com/whatust/transmission-rss/helper"
 	"github.com/whatust/transmission-rss/logger"
+	"github.com/whatust/transmission-rss/release"
 )
 
 // RSSClient methods to interact with the tranmission RPC server
 type RSSClient interface {
-	Initialize(*config.Config) error
-	AddFeeds([]config.Feed, helper.SeenTorrent)
+	Initialize(context.Context, *config.Config) error
+	AddFeeds(context.Context, []config.Feed, helper.SeenTorrent)
 }
 
 // RPCClient ...
@@ -27,18 +36,102 @@ type RPCClient struct {
 	SessionID string
 	Creds     config.Creds
 	Client    Client
+	// sessionMu guards the session ID shared by the RPC workers
+	sessionMu sync.RWMutex
 }
 
-// TransmissionClient wraps client methods and sessions
+// Keys of the pending torrents, failed adds by unique ID and held releases by
+// episode
+const (
+	pendingAddPrefix  = "add:"
+	pendingHeldPrefix = "held:"
+)
+
+// dryRunDownloadDir download path reported for the matchers falling back to
+// the Transmission download-dir, a dry run does not contact the server
+const dryRunDownloadDir = "<transmission download-dir>"
+
+// maxSessionRenewals number of times a request is replayed after a 409
+const maxSessionRenewals = 3
+
+// Post sends data to the RPC server, when the server answers 409 Conflict the
+// session ID is renewed from the response header and the request is replayed
+func (c *RPCClient) Post(ctx context.Context, data []byte) (*http.Response, error) {
+
+	for i := 0; i <= maxSessionRenewals; i++ {
+
+		c.sessionMu.RLock()
+		sessionID := c.SessionID
+		c.sessionMu.RUnlock()
+
+		req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(data))
+		if err != nil {
+			logger.Error("Unable to create POST request: %v\n", err)
+			return nil, err
+		}
+
+		req.SetBasicAuth(c.Creds.Username, c.Creds.Password)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Transmission-Session-Id", sessionID)
+
+		resp, err := c.Client.Do(req)
+		if err != nil {
+			logger.Error("Error during POST request: %v\n", err)
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusConflict {
+			return resp, nil
+		}
+
+		newSessionID := resp.Header.Get("X-Transmission-Session-Id")
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		if len(newSessionID) == 0 {
+			return nil, fmt.Errorf("Response 409 without session ID")
+		}
+
+		// Only the first worker to see the rotation updates the session ID
+		c.sessionMu.Lock()
+		if c.SessionID == sessionID {
+			c.SessionID = newSessionID
+			logger.Info("Session ID renewed: %v", newSessionID)
+		}
+		c.sessionMu.Unlock()
+	}
+
+	return nil, fmt.Errorf("Session ID still rejected after %v renewals", maxSessionRenewals)
+}
+
+// TransmissionClient wraps client methods and sessions, the RPC client is
+// shared by the copies of the client so a renewed session ID is kept
 type TransmissionClient struct {
-	RPCClient      RPCClient
+	RPCClient      *RPCClient
 	ConnectionConf config.Connect
 	TorrentPath    string
 	Proxy          string
+	DryRun         bool
+	Scheduler      *Scheduler
+	Cache          helper.FeedCache
+	History        helper.EpisodeHistory
+	// Candidates holds the episode releases until the best one is picked,
+	// NoWait picks it without waiting the window when polling once
+	Candidates *Collector
+	NoWait     bool
+	// Global matcher defaults and Transmission download-dir used as last fallback
+	Defaults    config.Defaults
+	DownloadDir string
+	// Global strategy building the unique ID of the items in the seen store
+	UID string
+	// Pending keeps the torrents not added yet across restarts, nil when the
+	// state backend does not keep them
+	Pending helper.PendingTorrents
 }
 
-// Initialize rpc client
-func (c *TransmissionClient) Initialize(conf *config.Config) error {
+// Initialize rpc client, an RPC client already set is kept with its session
+// ID and the download-dir of the client so a reload does not contact the server
+func (c *TransmissionClient) Initialize(ctx context.Context, conf *config.Config) error {
 
 	c.Proxy = conf.Proxy
 	c.TorrentPath = conf.TorrentPath
@@ -46,6 +139,15 @@ func (c *TransmissionClient) Initialize(conf *config.Config) error {
 		os.MkdirAll(c.TorrentPath, 0755)
 	}
 
+	c.ConnectionConf = conf.Connect
+	c.Defaults = conf.Defaults
+	c.UID = conf.UID
+
+	if c.RPCClient != nil {
+		logger.Info("Keeping RPC client of server: %v\n", c.RPCClient.URL)
+		return nil
+	}
+
 	var scheme string = "http"
 
 	if conf.Server.TLS {
@@ -57,34 +159,152 @@ func (c *TransmissionClient) Initialize(conf *config.Config) error {
 		Host:   conf.Server.Host + ":" + strconv.Itoa(conf.Server.Port),
 		Path:   conf.Server.RPCPath,
 	}
-	c.RPCClient.URL = URL.String()
 
-	logger.Info("Initializing Server: %v\n", c.RPCClient.URL)
+	rpcClient := &RPCClient{
+		URL:   URL.String(),
+		Creds: conf.Creds,
+		Client: NewRateClient(
+			conf.Server.Proxy,
+			conf.Server.ValidateCert,
+			conf.Connect.Timeout,
+			conf.Server.RateTime,
+		),
+	}
 
-	c.RPCClient.Client = NewRateClient(
-		conf.Server.Proxy,
-		conf.Server.ValidateCert,
-		conf.Connect.Timeout,
-		conf.Server.RateTime,
-	)
+	logger.Info("Initializing Server: %v\n", rpcClient.URL)
 
-	c.RPCClient.Creds = conf.Creds
-	c.ConnectionConf = conf.Connect
+	if c.DryRun {
+		logger.Info("Dry run: skipping session ID retrieval")
+		c.RPCClient = rpcClient
+		c.DownloadDir = dryRunDownloadDir
+		return nil
+	}
+
+	sessionID, err := c.getSessionID(ctx, rpcClient)
+	if err != nil {
+		return err
+	}
+	rpcClient.SessionID = sessionID
+	c.RPCClient = rpcClient
+
+	c.DownloadDir, err = c.getDownloadDir(ctx)
+	if err != nil {
+		logger.Warn("Could not retrieve Transmission download-dir: %v\n", err)
+	}
+
+	return nil
+}
+
+// SameServer returns true when the RPC client of the configuration can be
+// kept with the new one
+func SameServer(conf *config.Config, newConf *config.Config) bool {
+	return conf.Server == newConf.Server &&
+		conf.Creds == newConf.Creds &&
+		conf.Connect.Timeout == newConf.Connect.Timeout
+}
+
+type argumentsSession struct {
+	Fields []string `json:"fields"`
+}
 
-	sessionID, err := c.getSessionID()
-	c.RPCClient.SessionID = sessionID
+type getSessionArgs struct {
+	Method    string           `json:"method"`
+	Arguments argumentsSession `json:"arguments"`
+}
 
-	return err
+type respSession struct {
+	Arguments struct {
+		DownloadDir string `json:"download-dir"`
+	} `json:"arguments"`
+	Result string `json:"result"`
 }
 
-// RetriveFeed ...
-func (c TransmissionClient) RetriveFeed(client Client, url string) (*Feed, error) {
+// getDownloadDir returns the default download directory of the Transmission session
+func (c *TransmissionClient) getDownloadDir(ctx context.Context) (string, error) {
+
+	jsonData, _ := json.Marshal(getSessionArgs{
+		Method:    "session-get",
+		Arguments: argumentsSession{Fields: []string{"download-dir"}},
+	})
 
-	req, err := http.NewRequest("GET", url, nil)
+	resp, err := c.RPCClient.Post(ctx, jsonData)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body respSession
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", err
+	}
+
+	if body.Result != "success" {
+		return "", fmt.Errorf("Unable to get session: %v", body)
+	}
+
+	logger.Info("Transmission download-dir: %v\n", body.Arguments.DownloadDir)
+
+	return body.Arguments.DownloadDir, nil
+}
+
+// matchersHash identifies the matchers of the feed with their defaults and
+// unique ID strategy, the cache entry of the feed is ignored once they change
+func (c TransmissionClient) matchersHash(feed config.Feed) string {
+
+	matchers := make([]config.Matcher, 0, len(feed.Matchers))
+	for _, matcher := range feed.Matchers {
+		matchers = append(matchers, c.matcherDefaults(matcher, feed))
+	}
+
+	data, _ := json.Marshal(struct {
+		Matchers []config.Matcher
+		UID      string
+	}{matchers, c.uidStrategy(feed)})
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// DropChanged drops the cache entries of the feeds whose matchers changed
+func (c TransmissionClient) DropChanged(feeds []config.Feed) {
+
+	if c.Cache == nil {
+		return
+	}
+
+	for _, feed := range feeds {
+		if entry, ok := c.Cache.Get(feed.URL); ok && entry.Matchers != c.matchersHash(feed) {
+			logger.Info("Matchers changed, dropping feed cache: %v\n", feed.URL)
+			c.Cache.Delete(feed.URL)
+		}
+	}
+}
+
+// RetriveFeed retrieves the feed, the validators of the last retrieval are
+// sent unless the matchers changed since or in dry run
+func (c TransmissionClient) RetriveFeed(ctx context.Context, client Client, conf config.Feed) (*Feed, error) {
+
+	url := conf.URL
+	hash := c.matchersHash(conf)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	if c.Cache != nil && !c.DryRun {
+		if entry, ok := c.Cache.Get(url); ok && entry.Matchers == hash {
+			if len(entry.ETag) != 0 {
+				req.Header.Set("If-None-Match", entry.ETag)
+			}
+			if len(entry.LastModified) != 0 {
+				req.Header.Set("If-Modified-Since", entry.LastModified)
+			}
+		}
+	}
+
 	for i := 0; i < c.ConnectionConf.Retries; i++ {
 
 		resp, err := client.Do(req)
@@ -92,7 +312,15 @@ func (c TransmissionClient) RetriveFeed(client Client, url string) (*Feed, error
 		if err != nil {
 			logger.Error("Response error: %v", err)
 			logger.Error("Waiting %v seconds until retry", c.ConnectionConf.WaitTime)
-			time.Sleep(time.Duration(c.ConnectionConf.WaitTime) * time.Second)
+			err = sleepContext(ctx, time.Duration(c.ConnectionConf.WaitTime)*time.Second)
+			if err != nil {
+				return nil, err
+			}
+		} else if resp.StatusCode == http.StatusNotModified {
+
+			resp.Body.Close()
+			return &Feed{NotModified: true}, nil
+
 		} else {
 
 			feed := ParseResponseXML(resp, c.ConnectionConf.WaitTime)
@@ -102,6 +330,15 @@ func (c TransmissionClient) RetriveFeed(client Client, url string) (*Feed, error
 				continue
 			}
 
+			// A dry run leaves the cache so the next run retrieves the feed
+			if c.Cache != nil && !c.DryRun {
+				c.Cache.Set(url, helper.CacheEntry{
+					ETag:         resp.Header.Get("ETag"),
+					LastModified: resp.Header.Get("Last-Modified"),
+					Matchers:     hash,
+				})
+			}
+
 			return feed, nil
 		}
 	}
@@ -109,26 +346,34 @@ func (c TransmissionClient) RetriveFeed(client Client, url string) (*Feed, error
 	return nil, fmt.Errorf("All retries failed could not retrieve RSS Feed")
 }
 
-func (c TransmissionClient) getSessionID() (string, error) {
+// getSessionID retrieves the session ID of the server retrying on failures
+// until the context is canceled
+func (c TransmissionClient) getSessionID(ctx context.Context, rpcClient *RPCClient) (string, error) {
 
 	var sessionID string
 
-	logger.Info("Getting session ID from: %v", c.RPCClient.URL)
+	logger.Info("Getting session ID from: %v", rpcClient.URL)
 
-	req, err := http.NewRequest("GET", c.RPCClient.URL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", rpcClient.URL, nil)
 	if err != nil {
 		return "", err
 	}
-	req.SetBasicAuth(c.RPCClient.Creds.Username, c.RPCClient.Creds.Password)
+	req.SetBasicAuth(rpcClient.Creds.Username, rpcClient.Creds.Password)
 
 	for i := 0; i < c.ConnectionConf.Retries; i++ {
 
-		resp, err := c.RPCClient.Client.Do(req)
+		resp, err := rpcClient.Client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
 
 		if err != nil || resp.StatusCode != 409 {
 			logger.Error("Unable to get sessionID: %v", err)
 			logger.Error("Waiting %v seconds until retry\n", c.ConnectionConf.WaitTime)
-			time.Sleep(time.Duration(c.ConnectionConf.WaitTime) * time.Second)
+			err = sleepContext(ctx, time.Duration(c.ConnectionConf.WaitTime)*time.Second)
+			if err != nil {
+				return "", err
+			}
 		} else {
 			sessionID = resp.Header.Get("X-Transmission-Session-Id")
 			break
@@ -146,13 +391,19 @@ func (c TransmissionClient) getSessionID() (string, error) {
 var wg = sync.WaitGroup{}
 var wc = sync.WaitGroup{}
 
-// AddFeeds ...
-func (c TransmissionClient) AddFeeds(confs []config.Feed, seen helper.SeenTorrent) {
+// AddFeeds retrieves the feeds and queues the matching torrents, once the
+// context is canceled no new feed is fetched and the queued adds are drained
+func (c TransmissionClient) AddFeeds(ctx context.Context, confs []config.Feed, seen helper.SeenTorrent) {
 
 	channel := make(chan TorrentReq, 50)
 
 	wc.Add(1)
-	go addTorrentURL(channel, &c.RPCClient, c.ConnectionConf, seen)
+	if c.DryRun {
+		go reportTorrent(channel, os.Stdout, seen, c.History)
+	} else {
+		go addTorrentURL(ctx, channel, c.RPCClient, c.ConnectionConf, seen, c.Cache, c.History, c.Pending)
+		c.replayPending(channel, seen)
+	}
 
 	client := NewRateClient(
 		c.Proxy,
@@ -163,47 +414,216 @@ func (c TransmissionClient) AddFeeds(confs []config.Feed, seen helper.SeenTorren
 
 	for _, conf := range confs {
 
+		if ctx.Err() != nil {
+			logger.Info("Shutting down, skipping remaining feeds")
+			break
+		}
+
 		client.Client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify = !conf.ValidateCert
 
 		logger.Info("Retriving feed from: %v", conf.URL)
-		feed, err := c.RetriveFeed(client, conf.URL)
+		feed, err := c.RetriveFeed(ctx, client, conf)
 		if err != nil {
 			logger.Error("Could not retrieve RSS feed: %v\n", err)
 			continue
 		}
 
+		if feed.NotModified {
+			logger.Info("Feed not modified since last poll: %v", conf.URL)
+			continue
+		}
+
+		if c.Scheduler != nil {
+			c.Scheduler.SetTTL(conf.URL, feed.Channel.TTL)
+		}
+
+		failed := false
+
 		for _, matcher := range conf.Matchers {
 
 			logger.Info("Processing match: %v\n", matcher.RegExp)
 
-			filter, err := CreateFilter(matcher)
+			filter, err := CreateFilter(c.matcherDefaults(matcher, conf))
 			if err != nil {
 				logger.Error("Error while creating torrent filter: %v\n", err)
+				failed = true
 				continue
 			}
 
 			for _, item := range feed.Channel.Items {
 
 				wg.Add(1)
-				go c.processItem(item, filter, channel, seen)
+				go c.processItem(item, conf, matcher.RegExp, filter, channel, seen)
 			}
 		}
 		wg.Wait()
+
+		// Items of the failed matchers are checked again on the next poll
+		if failed && c.Cache != nil && !c.DryRun {
+			c.Cache.Delete(conf.URL)
+		}
 	}
 
+	if ctx.Err() == nil {
+		c.addCandidates(channel, time.Now())
+	}
+	c.dropHeld()
+	c.saveHeld()
+
 	close(channel)
 	wc.Wait()
 }
 
+// addCandidates queues the best release of the episodes whose window ended
+func (c TransmissionClient) addCandidates(channel chan<- TorrentReq, now time.Time) {
+
+	if c.Candidates == nil {
+		return
+	}
+
+	for _, cand := range c.Candidates.Take(now, c.NoWait) {
+
+		if c.Pending != nil && !c.DryRun {
+			c.Pending.Delete(pendingHeldPrefix + cand.req.EpisodeKey)
+		}
+
+		if !c.History.Claim(cand.req.EpisodeKey, cand.req.EpisodeEntry, cand.filter.upgrade(cand.req.EpisodeEntry)) {
+			logger.Info("Episode already grabbed: %v\n", cand.req.Title)
+			continue
+		}
+
+		logger.Info("Best episode candidate: %v\n", cand.req.Title)
+		channel <- cand.req
+	}
+}
+
+// dropHeld drops the cache entries of the feeds with held releases, the
+// releases are only kept in memory so the feeds are retrieved again until
+// they are added, even after a crash
+func (c TransmissionClient) dropHeld() int {
+
+	if c.Candidates == nil || c.Cache == nil || c.DryRun {
+		return 0
+	}
+
+	feeds := make(map[string]bool)
+	for _, req := range c.Candidates.Held() {
+		if !feeds[req.Feed] {
+			logger.Debug("Dropping feed cache with held episodes: %v\n", req.Feed)
+			c.Cache.Delete(req.Feed)
+			feeds[req.Feed] = true
+		}
+	}
+
+	return len(feeds)
+}
+
+// saveHeld keeps the held releases as pending so they are added after a
+// restart even when the feed no longer lists them
+func (c TransmissionClient) saveHeld() {
+
+	if c.Candidates == nil || c.Pending == nil || c.DryRun {
+		return
+	}
+
+	for _, req := range c.Candidates.Held() {
+		c.Pending.Put(pendingHeldPrefix+req.EpisodeKey, req)
+	}
+}
+
+// replayPending queues again the torrents that were not added by a previous
+// poll or run, releases held by this process wait for the end of their window
+// and releases held by a previous run are queued right away
+func (c TransmissionClient) replayPending(channel chan<- TorrentReq, seen helper.SeenTorrent) {
+
+	if c.Pending == nil || c.DryRun {
+		return
+	}
+
+	for key, data := range c.Pending.All() {
+
+		var req TorrentReq
+		if err := json.Unmarshal(data, &req); err != nil {
+			logger.Warn("Dropping invalid pending torrent %v: %v\n", key, err)
+			c.Pending.Delete(key)
+			continue
+		}
+
+		if strings.HasPrefix(key, pendingHeldPrefix) && c.Candidates != nil && c.Candidates.Holds(req.EpisodeKey) {
+			continue
+		}
+
+		if seen.Contain(req.UID) {
+			c.Pending.Delete(key)
+			continue
+		}
+
+		// Already queued by another poll
+		if !seen.Reserve(req.UID) {
+			continue
+		}
+
+		if c.History != nil && len(req.EpisodeKey) != 0 && !c.History.Claim(req.EpisodeKey, req.EpisodeEntry, nil) {
+			logger.Info("Episode already grabbed: %v\n", req.Title)
+			seen.Release(req.UID)
+			c.Pending.Delete(key)
+			continue
+		}
+
+		// Torrents failing again are kept as pending by addTorrentURL
+		logger.Info("Retrying pending torrent: %v\n", req.Title)
+		c.Pending.Delete(key)
+		channel <- req
+	}
+}
+
+// matcherDefaults fills the unset matcher values from the feed defaults, then
+// the global defaults and last the download-dir of the Transmission session
+func (c TransmissionClient) matcherDefaults(matcher config.Matcher, feed config.Feed) config.Matcher {
+
+	matcher = matcher.WithDefaults(feed.Defaults).WithDefaults(c.Defaults)
+
+	if len(matcher.DownloadPath) == 0 {
+		matcher.DownloadPath = c.DownloadDir
+	}
+
+	return matcher
+}
+
 // TorrentReq ...
 type TorrentReq struct {
+	Feed         string
+	Matcher      string
 	Link         string
+	Magnet       string
 	Title        string
+	UID          string
+	InfoHash     string
 	DownloadPath string
 	TorrentPath  string
+	// Seeding policy of the feed
+	SeedRatioLimit float64
+	SeedIdleLimit  int
+	AddOptions     config.AddOptions
+	// Episode claimed in the history, empty when not tracked
+	EpisodeKey   string
+	EpisodeEntry helper.HistoryEntry
+}
+
+// seenEntry returns the record of the added torrent in the seen store
+func (req TorrentReq) seenEntry() helper.SeenEntry {
+	return helper.SeenEntry{
+		UID:      req.UID,
+		Title:    req.Title,
+		Feed:     req.Feed,
+		Matcher:  req.Matcher,
+		InfoHash: req.InfoHash,
+		Link:     req.Link,
+		Added:    time.Now(),
+	}
 }
 
-func (c TransmissionClient) processItem(item FeedItem, filter *Filter, channel chan<- TorrentReq, seen helper.SeenTorrent) {
+func (c TransmissionClient) processItem(item FeedItem, feed config.Feed, matcher string, filter *Filter, channel chan<- TorrentReq, seen helper.SeenTorrent) {
 
 	defer wg.Done()
 
@@ -212,15 +632,102 @@ func (c TransmissionClient) processItem(item FeedItem, filter *Filter, channel c
 		return
 	}
 
-	if seen.Contain(item.Title) {
+	// Items of legacy seen files were saved by title
+	uid := itemUID(item, c.uidStrategy(feed))
+	if seen.Contain(uid) || (uid != item.Title && seen.ContainLegacy(item.Title)) {
 		logger.Info("Torrent already seen: %v\n", item.Title)
 		return
 	}
 
-	channel <- TorrentReq{
-		Link:         item.Link,
-		Title:        item.Title,
-		DownloadPath: filter.DownloadPath,
-		TorrentPath:  path.Join(c.TorrentPath, item.Title+".torrent"),
+	// Magnet built from the info hash is used when the link fails or is missing
+	link := strings.TrimSpace(item.TorrentLink())
+	magnet := strings.TrimSpace(item.MagnetURL)
+	if len(magnet) == 0 {
+		magnet = magnetLink(item.InfoHash, item.Title, feed.Trackers)
+	}
+
+	if len(link) == 0 {
+		link, magnet = magnet, ""
+	} else if isMagnet(link) {
+		magnet = ""
+	}
+
+	if len(link) == 0 {
+		logger.Error("Torrent without link or info hash: %v\n", item.Title)
+		return
+	}
+
+	downloadPath, err := filter.ResolvePath(item, feedName(feed.Name, feed.URL))
+	if err != nil {
+		logger.Error("Could not resolve download path of %v: %v\n", item.Title, err)
+		return
+	}
+
+	req := TorrentReq{
+		Feed:           feed.URL,
+		Matcher:        matcher,
+		Link:           link,
+		Magnet:         magnet,
+		Title:          item.Title,
+		UID:            uid,
+		InfoHash:       uidField(item, "infoHash"),
+		DownloadPath:   downloadPath,
+		TorrentPath:    path.Join(c.TorrentPath, item.Title+".torrent"),
+		SeedRatioLimit: feed.SeedRatioLimit,
+		SeedIdleLimit:  feed.SeedIdleLimit,
+		AddOptions:     filter.AddOptions,
+	}
+
+	// Other releases of the episode are skipped once it is claimed, when
+	// collecting candidates the best release is claimed after its window
+	if filter.Episodes && c.History != nil {
+
+		info := release.Parse(item.Title)
+
+		key, ok := episodeKey(info)
+		if !ok {
+			logger.Warn("Could not parse episode, tracking by title only: %v\n", item.Title)
+		} else {
+			req.EpisodeKey = key
+			req.EpisodeEntry = helper.HistoryEntry{
+				Title:   item.Title,
+				Version: info.Version,
+				Quality: info.Resolution,
+				Proper:  info.Proper,
+				Added:   time.Now(),
+			}
+
+			if !filter.wanted(req.EpisodeEntry.Quality) {
+				logger.Info("Quality not wanted: %v\n", item.Title)
+				return
+			}
+
+			upgrade := filter.upgrade(req.EpisodeEntry)
+
+			if c.Candidates != nil {
+				grabbed, ok := c.History.Get(req.EpisodeKey)
+				if ok && (upgrade == nil || !upgrade(grabbed)) {
+					logger.Info("Episode already grabbed: %v\n", item.Title)
+					return
+				}
+				logger.Info("Holding episode candidate: %v\n", item.Title)
+				c.Candidates.Add(req, filter, time.Now())
+				return
+			}
+
+			if !c.History.Claim(req.EpisodeKey, req.EpisodeEntry, upgrade) {
+				logger.Info("Episode already grabbed: %v\n", item.Title)
+				return
+			}
+		}
+	}
+
+	// Items matched by several matchers or feeds are queued once
+	if !seen.Reserve(uid) {
+		logger.Info("Torrent already queued: %v\n", item.Title)
+		releaseEpisode(req, c.History)
+		return
 	}
+
+	channel <- req
 }
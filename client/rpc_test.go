@@ -1,13 +1,23 @@
 package client
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/whatust/transmission-rss/config"
+	"github.com/whatust/transmission-rss/helper"
 )
 
 func TestSessionID(t *testing.T) {
@@ -29,7 +39,7 @@ func TestSessionID(t *testing.T) {
 		}))
 
 		client := TransmissionClient{
-			RPCClient: RPCClient{
+			RPCClient: &RPCClient{
 				URL: server.URL,
 				Client: NewRateClient("", false, 0, 0 ),
 				Creds: config.Creds{
@@ -43,7 +53,7 @@ func TestSessionID(t *testing.T) {
 			},
 		}
 
-		sessionID, err := client.getSessionID()
+		sessionID, err := client.getSessionID(context.Background(), client.RPCClient)
 
 		if err == nil {
 			if sessionID != test.expected {
@@ -59,6 +69,77 @@ func TestSessionID(t *testing.T) {
 	
 }
 
+func TestSessionIDCanceled(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := TransmissionClient{
+		ConnectionConf: config.Connect{
+			Retries:  10,
+			WaitTime: 60,
+		},
+	}
+	rpcClient := &RPCClient{URL: server.URL, Client: server.Client()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	if _, err := client.getSessionID(ctx, rpcClient); err == nil {
+		t.Errorf("Test Failed: session ID retrieved from unavailable server")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Test Failed: retries kept waiting %v after cancellation", elapsed)
+	}
+}
+
+func TestInitializeKeepRPCClient(t *testing.T) {
+
+	rpcClient := &RPCClient{URL: "http://localhost:1/transmission/rpc", SessionID: "sessionID"}
+
+	// The server is not contacted when the RPC client is kept
+	client := TransmissionClient{RPCClient: rpcClient, DownloadDir: "/downloads"}
+
+	conf := config.NewConfig()
+	conf.Connect.Retries = 3
+
+	if err := client.Initialize(context.Background(), &conf); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	if client.RPCClient != rpcClient || client.RPCClient.SessionID != "sessionID" ||
+		client.DownloadDir != "/downloads" || client.ConnectionConf.Retries != 3 {
+		t.Errorf("Test Failed: RPC client not kept: %+v", client)
+	}
+
+	var tests = []struct {
+		change   func(*config.Config)
+		expected bool
+	}{
+		{func(c *config.Config) {}, true},
+		{func(c *config.Config) { c.Interval = 60 }, true},
+		{func(c *config.Config) { c.Server.Port = 9092 }, false},
+		{func(c *config.Config) { c.Creds.Password = "other" }, false},
+		{func(c *config.Config) { c.Connect.Timeout = 30 }, false},
+	}
+
+	for idx, test := range tests {
+
+		conf, newConf := config.NewConfig(), config.NewConfig()
+		test.change(&newConf)
+
+		if same := SameServer(&conf, &newConf); same != test.expected {
+			t.Errorf("Test %v Failed: same server %v, expected %v", idx, same, test.expected)
+		}
+	}
+}
+
 func TestInitialize(t *testing.T) {
 
 	var tests = []struct{
@@ -89,7 +170,7 @@ func TestInitialize(t *testing.T) {
 			TransmissionClient{
 				Proxy: "",
 				TorrentPath: "",
-				RPCClient: RPCClient{
+				RPCClient: &RPCClient{
 					URL: "",
 					Creds: config.Creds {
 						Username: "transmission",
@@ -129,7 +210,7 @@ func TestInitialize(t *testing.T) {
 			test.expected.RPCClient.URL = server.URL+test.conf.Server.RPCPath
 		}
 
-		err := client.Initialize(test.conf)
+		err := client.Initialize(context.Background(), test.conf)
 
 		if err == nil {
 			if test.expected.RPCClient.URL != client.(*TransmissionClient).RPCClient.URL ||
@@ -144,4 +225,533 @@ func TestInitialize(t *testing.T) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+func TestSessionRenewal(t *testing.T) {
+
+	var tests = []struct {
+		workers  int
+		expected string
+	}{
+		{1, "newSessionID"},
+		{10, "newSessionID"},
+	}
+
+	for idx, test := range tests {
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Transmission-Session-Id") != "newSessionID" {
+				w.Header().Add("X-Transmission-Session-Id", "newSessionID")
+				w.WriteHeader(409)
+				return
+			}
+			fmt.Fprintf(w, "{\"result\":\"success\"}")
+		}))
+
+		clientRPC := RPCClient{
+			URL:       server.URL,
+			SessionID: "oldSessionID",
+			Creds: config.Creds{
+				Username: "transmission",
+				Password: "transmission",
+			},
+			Client: server.Client(),
+		}
+
+		var wait sync.WaitGroup
+		errs := make(chan error, test.workers)
+
+		for i := 0; i < test.workers; i++ {
+			wait.Add(1)
+			go func() {
+				defer wait.Done()
+				_, err := addTorrent(context.Background(), []byte("{}"), &clientRPC)
+				errs <- err
+			}()
+		}
+		wait.Wait()
+		close(errs)
+		server.Close()
+
+		for err := range errs {
+			if err != nil {
+				t.Errorf("Test %v Failed: unexpected error %v", idx, err)
+			}
+		}
+
+		if clientRPC.SessionID != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, clientRPC.SessionID, test.expected)
+		}
+	}
+}
+
+func TestSessionRenewalCycles(t *testing.T) {
+
+	conflicts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Transmission-Session-Id") != "newSessionID" {
+			conflicts++
+			w.Header().Add("X-Transmission-Session-Id", "newSessionID")
+			w.WriteHeader(409)
+			return
+		}
+		fmt.Fprintf(w, "{\"result\":\"success\"}")
+	}))
+	defer server.Close()
+
+	client := TransmissionClient{
+		RPCClient: &RPCClient{
+			URL:       server.URL,
+			SessionID: "oldSessionID",
+			Client:    server.Client(),
+		},
+	}
+
+	// Each cycle works on a copy of the client like AddFeeds
+	cycle := func(c TransmissionClient) error {
+		_, err := addTorrent(context.Background(), []byte("{}"), c.RPCClient)
+		return err
+	}
+
+	for idx := 0; idx < 3; idx++ {
+		if err := cycle(client); err != nil {
+			t.Errorf("Test %v Failed: unexpected error %v", idx, err)
+		}
+	}
+
+	if conflicts != 1 || client.RPCClient.SessionID != "newSessionID" {
+		t.Errorf("Test Failed: %v renewals, session ID %v", conflicts, client.RPCClient.SessionID)
+	}
+}
+
+func TestRetriveFeedConditional(t *testing.T) {
+
+	data, err := ioutil.ReadFile("../test/feed/feed1.xml")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == "\"etag\"" &&
+			r.Header.Get("If-Modified-Since") == "Sat, 01 Jan 2000 00:00:00 GMT" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", "\"etag\"")
+		w.Header().Set("Last-Modified", "Sat, 01 Jan 2000 00:00:00 GMT")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	client := TransmissionClient{
+		ConnectionConf: config.Connect{
+			Retries: 1,
+		},
+		Cache: &helper.CacheMap{
+			Entries: make(map[string]helper.CacheEntry),
+		},
+	}
+
+	feed1 := config.Feed{URL: server.URL, Matchers: []config.Matcher{{RegExp: "title[12]", DownloadPath: "/downloads"}}}
+	feed2 := config.Feed{URL: server.URL, Matchers: []config.Matcher{{RegExp: "title[1234]", DownloadPath: "/downloads"}}}
+
+	// Validators of other matchers are not sent
+	var tests = []struct {
+		feed        config.Feed
+		notModified bool
+		items       int
+	}{
+		{feed1, false, 4},
+		{feed1, true, 0},
+		{feed2, false, 4},
+		{feed2, true, 0},
+	}
+
+	for idx, test := range tests {
+
+		feed, err := client.RetriveFeed(context.Background(), server.Client(), test.feed)
+		if err != nil {
+			t.Errorf("Test %v Failed: %v", idx, err)
+			continue
+		}
+
+		if feed.NotModified != test.notModified || len(feed.Channel.Items) != test.items {
+			t.Errorf("Test %v Failed: not modified %v with %v items, expected %v with %v items",
+				idx, feed.NotModified, len(feed.Channel.Items), test.notModified, test.items)
+		}
+	}
+
+	// A reload drops the entries of the feeds whose matchers changed
+	client.DropChanged([]config.Feed{feed2})
+	if _, ok := client.Cache.Get(server.URL); !ok {
+		t.Errorf("Test Failed: cache entry of unchanged feed dropped")
+	}
+	client.DropChanged([]config.Feed{feed1})
+	if _, ok := client.Cache.Get(server.URL); ok {
+		t.Errorf("Test Failed: cache entry of changed feed kept")
+	}
+
+	// A failed add drops the cache entry so the feed is retrieved again
+	client.RetriveFeed(context.Background(), server.Client(), feed1)
+	client.Cache.Delete(server.URL)
+
+	feed, err := client.RetriveFeed(context.Background(), server.Client(), feed1)
+	if err != nil || feed.NotModified {
+		t.Errorf("Test Failed: feed not retrieved after cache entry deletion")
+	}
+}
+
+func TestRetriveFeedDryRun(t *testing.T) {
+
+	data, err := ioutil.ReadFile("../test/feed/feed1.xml")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == "\"etag\"" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", "\"etag\"")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "transmission-rss")
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := helper.OpenBoltDB(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	defer db.Close()
+
+	client := TransmissionClient{
+		DryRun: true,
+		ConnectionConf: config.Connect{
+			Retries: 1,
+		},
+		Cache: db.Cache(),
+	}
+
+	conf := config.Feed{URL: server.URL}
+
+	// Every dry run retrieves the feed, the database is left untouched
+	for idx := 0; idx < 2; idx++ {
+
+		feed, err := client.RetriveFeed(context.Background(), server.Client(), conf)
+		if err != nil || feed.NotModified || len(feed.Channel.Items) != 4 {
+			t.Errorf("Test %v Failed: feed not retrieved in dry run", idx)
+		}
+	}
+
+	if _, ok := client.Cache.Get(server.URL); ok {
+		t.Errorf("Test Failed: dry run saved the feed cache")
+	}
+
+	// A dry run after a real run does not send the validators
+	client.DryRun = false
+	client.RetriveFeed(context.Background(), server.Client(), conf)
+	client.DryRun = true
+
+	feed, err := client.RetriveFeed(context.Background(), server.Client(), conf)
+	if err != nil || feed.NotModified || len(feed.Channel.Items) != 4 {
+		t.Errorf("Test Failed: feed not retrieved in dry run after a real run")
+	}
+}
+
+func TestAddFeedsFilterError(t *testing.T) {
+
+	data, err := ioutil.ReadFile("../test/feed/feed1.xml")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", "\"etag\"")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	cache := &helper.CacheMap{}
+
+	client := TransmissionClient{
+		ConnectionConf: config.Connect{
+			Retries: 1,
+		},
+		Cache: cache,
+	}
+
+	var tests = []struct {
+		downloadPath string
+		cached       bool
+	}{
+		{"/downloads", true},
+		// Without the Transmission download-dir the matcher can not be used
+		{"", false},
+	}
+
+	for idx, test := range tests {
+
+		cache.Delete(server.URL)
+
+		feed := config.Feed{
+			URL:          server.URL,
+			ValidateCert: true,
+			Matchers:     []config.Matcher{{RegExp: "^$", DownloadPath: test.downloadPath}},
+		}
+		client.AddFeeds(context.Background(), []config.Feed{feed}, &helper.SeenSet{})
+
+		if _, ok := cache.Get(server.URL); ok != test.cached {
+			t.Errorf("Test %v Failed: feed cached %v, expected %v", idx, ok, test.cached)
+		}
+	}
+}
+
+func TestGetDownloadDir(t *testing.T) {
+
+	var tests = []struct {
+		response    string
+		expected    string
+		expectedErr error
+	}{
+		{`{"arguments":{"download-dir":"/downloads"},"result":"success"}`, "/downloads", nil},
+		{`{"arguments":{},"result":"error"}`, "", fmt.Errorf("Unable to get session")},
+		{`not json`, "", fmt.Errorf("invalid character")},
+	}
+
+	for idx, test := range tests {
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if !strings.Contains(string(body), `"session-get"`) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(test.response))
+		}))
+
+		client := TransmissionClient{
+			RPCClient: &RPCClient{
+				URL:    server.URL,
+				Client: NewRateClient("", false, 0, 0),
+			},
+		}
+
+		downloadDir, err := client.getDownloadDir(context.Background())
+
+		if (err == nil) != (test.expectedErr == nil) {
+			t.Errorf("Test %v Failed: Errors do not match %v, expected %v", idx, err, test.expectedErr)
+		}
+		if downloadDir != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, downloadDir, test.expected)
+		}
+
+		server.Close()
+	}
+}
+
+func TestMatcherDefaults(t *testing.T) {
+
+	yes := true
+
+	client := TransmissionClient{
+		Defaults: config.Defaults{
+			DownloadPath: "/global",
+			OnlyTrusted:  &yes,
+		},
+		DownloadDir: "/transmission",
+	}
+
+	var tests = []struct {
+		client   TransmissionClient
+		feed     config.Feed
+		matcher  config.Matcher
+		expected string
+	}{
+		{client, config.Feed{}, config.Matcher{DownloadPath: "/matcher"}, "/matcher"},
+		{client, config.Feed{Defaults: config.Defaults{DownloadPath: "/feed"}}, config.Matcher{}, "/feed"},
+		{client, config.Feed{}, config.Matcher{}, "/global"},
+		{TransmissionClient{DownloadDir: "/transmission"}, config.Feed{}, config.Matcher{}, "/transmission"},
+	}
+
+	for idx, test := range tests {
+
+		matcher := test.client.matcherDefaults(test.matcher, test.feed)
+
+		if matcher.DownloadPath != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, matcher.DownloadPath, test.expected)
+		}
+		if (matcher.OnlyTrusted != nil) != (test.client.Defaults.OnlyTrusted != nil) {
+			t.Errorf("Test %v Failed: onlyTrusted not inherited from global defaults", idx)
+		}
+	}
+}
+
+func TestInitializeDryRun(t *testing.T) {
+
+	client := TransmissionClient{DryRun: true}
+
+	err := client.Initialize(context.Background(), &config.Config{Server: config.Server{Host: "localhost", Port: 9091}})
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	// Matchers using the Transmission download-dir are still reported
+	filter, err := CreateFilter(client.matcherDefaults(config.Matcher{RegExp: "Show"}, config.Feed{}))
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	if filter.DownloadPath != dryRunDownloadDir {
+		t.Errorf("Test Failed:\nGot:      %v\nExpected: %v", filter.DownloadPath, dryRunDownloadDir)
+	}
+}
+
+func TestSeenEntry(t *testing.T) {
+
+	filter := &Filter{
+		RegExp:       regexp.MustCompile("Show"),
+		DownloadPath: "/downloads",
+	}
+
+	channel := make(chan TorrentReq, 1)
+
+	wg.Add(1)
+	client := TransmissionClient{UID: "guid"}
+	client.processItem(
+		FeedItem{Title: "Show - 01", GUID: "1", Link: "magnet:?xt=urn:btih:ABCDEF"},
+		config.Feed{URL: "http://feed.com"},
+		"Show",
+		filter,
+		channel,
+		&helper.SeenSet{},
+	)
+	close(channel)
+
+	req := <-channel
+	entry := req.seenEntry()
+
+	expected := helper.SeenEntry{
+		UID:      "guid:1",
+		Title:    "Show - 01",
+		Feed:     "http://feed.com",
+		Matcher:  "Show",
+		InfoHash: "abcdef",
+		Link:     "magnet:?xt=urn:btih:ABCDEF",
+		Added:    entry.Added,
+	}
+
+	if entry != expected || entry.Added.IsZero() {
+		t.Errorf("Test Failed:\nGot:      %+v\nExpected: %+v", entry, expected)
+	}
+}
+
+func TestProcessItemConcurrent(t *testing.T) {
+
+	filters := []*Filter{
+		{RegExp: regexp.MustCompile("Show"), DownloadPath: "/downloads"},
+		{RegExp: regexp.MustCompile("01"), DownloadPath: "/other"},
+	}
+
+	const feeds = 4
+
+	seen := helper.SeenSet{}
+	channel := make(chan TorrentReq, feeds*len(filters))
+
+	// The same item matched by several matchers of several feeds
+	var group sync.WaitGroup
+	for f := 0; f < feeds; f++ {
+		for _, filter := range filters {
+			group.Add(1)
+			wg.Add(1)
+			go func(f int, filter *Filter) {
+				defer group.Done()
+				client := TransmissionClient{UID: "guid"}
+				client.processItem(
+					FeedItem{Title: "Show - 01", GUID: "1", Link: "http://example.com/1"},
+					config.Feed{URL: "http://feed" + strconv.Itoa(f) + ".com"},
+					filter.RegExp.String(),
+					filter,
+					channel,
+					&seen,
+				)
+			}(f, filter)
+		}
+	}
+	group.Wait()
+	close(channel)
+
+	if queued := len(channel); queued != 1 {
+		t.Errorf("Test Failed: item queued %v times, expected once", queued)
+	}
+
+	// Items that could not be added are queued again
+	seen.Release("guid:1")
+
+	channel = make(chan TorrentReq, 1)
+	wg.Add(1)
+	client := TransmissionClient{UID: "guid"}
+	client.processItem(FeedItem{Title: "Show - 01", GUID: "1", Link: "http://example.com/1"}, config.Feed{URL: "http://feed.com"}, "Show", filters[0], channel, &seen)
+	close(channel)
+
+	if queued := len(channel); queued != 1 {
+		t.Errorf("Test Failed: released item queued %v times, expected once", queued)
+	}
+}
+
+func TestReplayPending(t *testing.T) {
+
+	pending, cleanup := openPending(t)
+	defer cleanup()
+
+	seen := helper.SeenSet{}
+	seen.AddSeen(helper.SeenEntry{UID: "added"})
+
+	history := &helper.HistoryMap{}
+	history.Commit("show E03", helper.HistoryEntry{Title: "Show - 03"})
+
+	filter := &Filter{Wait: time.Hour}
+
+	client := TransmissionClient{
+		History:    history,
+		Pending:    pending,
+		Candidates: NewCollector(),
+	}
+	client.Candidates.Add(TorrentReq{UID: "held", EpisodeKey: "show E04"}, filter, time.Now())
+
+	pending.Put(pendingAddPrefix+"failed", TorrentReq{UID: "failed", Title: "failed"})
+	pending.Put(pendingAddPrefix+"added", TorrentReq{UID: "added"})
+	pending.Put(pendingHeldPrefix+"show E02", TorrentReq{UID: "restart", EpisodeKey: "show E02"})
+	pending.Put(pendingHeldPrefix+"show E03", TorrentReq{UID: "grabbed", EpisodeKey: "show E03"})
+	pending.Put(pendingHeldPrefix+"show E04", TorrentReq{UID: "held", EpisodeKey: "show E04"})
+
+	channel := make(chan TorrentReq, 5)
+	client.replayPending(channel, &seen)
+	close(channel)
+
+	queued := make(map[string]bool)
+	for req := range channel {
+		queued[req.UID] = true
+	}
+
+	expected := map[string]bool{"failed": true, "restart": true}
+	if !reflect.DeepEqual(queued, expected) {
+		t.Errorf("Test Failed:\nGot:      %v\nExpected: %v", queued, expected)
+	}
+
+	// Releases held by the process stay pending until their window ends
+	left := pending.All()
+	if _, ok := left[pendingHeldPrefix+"show E04"]; !ok || len(left) != 1 {
+		t.Errorf("Test Failed: pending torrents left %v", left)
+	}
+
+	client.addCandidates(make(chan TorrentReq, 1), time.Now().Add(2*time.Hour))
+	if left := pending.All(); len(left) != 0 {
+		t.Errorf("Test Failed: taken release still pending %v", left)
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/whatust/transmission-rss/config"
+	"github.com/whatust/transmission-rss/logger"
+)
+
+// Scheduler keeps track of when each feed must be polled again
+type Scheduler struct {
+	Interval time.Duration
+	Jitter   time.Duration
+	next     map[string]time.Time
+	ttl      map[string]time.Duration
+	rand     *rand.Rand
+}
+
+// NewScheduler creates a scheduler from the global interval and jitter in seconds
+func NewScheduler(interval int, jitter int) *Scheduler {
+
+	return &Scheduler{
+		Interval: time.Duration(interval) * time.Second,
+		Jitter:   time.Duration(jitter) * time.Second,
+		next:     make(map[string]time.Time),
+		ttl:      make(map[string]time.Duration),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Due returns the feeds that must be polled at the given time
+func (s *Scheduler) Due(feeds []config.Feed, now time.Time) []config.Feed {
+
+	var due []config.Feed
+
+	for _, feed := range feeds {
+		next, ok := s.next[feed.URL]
+		if !ok || !next.After(now) {
+			due = append(due, feed)
+		}
+	}
+
+	return due
+}
+
+// SetTTL records the time to live in minutes advertised by the feed
+func (s *Scheduler) SetTTL(url string, ttl int) {
+
+	if ttl > 0 {
+		s.ttl[url] = time.Duration(ttl) * time.Minute
+	} else {
+		delete(s.ttl, url)
+	}
+}
+
+// Done schedules the next poll of the feeds polled at the given time
+func (s *Scheduler) Done(feeds []config.Feed, now time.Time) {
+
+	for _, feed := range feeds {
+
+		interval := s.Interval
+		if feed.Interval > 0 {
+			interval = time.Duration(feed.Interval) * time.Second
+		}
+
+		// Do not poll sooner than the feed asks to be cached
+		if ttl, ok := s.ttl[feed.URL]; ok && ttl > interval {
+			logger.Debug("Using feed TTL %v for: %v\n", ttl, feed.URL)
+			interval = ttl
+		}
+
+		if s.Jitter > 0 {
+			interval += time.Duration(s.rand.Int63n(int64(s.Jitter)))
+		}
+
+		s.next[feed.URL] = now.Add(interval)
+		logger.Debug("Next poll of %v at %v\n", feed.URL, s.next[feed.URL])
+	}
+}
+
+// Next returns the time of the earliest poll among the feeds
+func (s *Scheduler) Next(feeds []config.Feed) time.Time {
+
+	var next time.Time
+
+	for _, feed := range feeds {
+
+		feedNext, ok := s.next[feed.URL]
+		if !ok {
+			return time.Now()
+		}
+
+		if next.IsZero() || feedNext.Before(next) {
+			next = feedNext
+		}
+	}
+
+	if next.IsZero() {
+		next = time.Now().Add(s.Interval)
+	}
+
+	return next
+}
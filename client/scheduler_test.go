@@ -0,0 +1,54 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whatust/transmission-rss/config"
+)
+
+func TestScheduler(t *testing.T) {
+
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		feed     config.Feed
+		ttl      int
+		jitter   int
+		expected time.Duration
+	}{
+		{config.Feed{URL: "http://feed1.com"}, 0, 0, 300 * time.Second},
+		{config.Feed{URL: "http://feed2.com", Interval: 60}, 0, 0, 60 * time.Second},
+		{config.Feed{URL: "http://feed3.com", Interval: 60}, 10, 0, 10 * time.Minute},
+		{config.Feed{URL: "http://feed4.com"}, 1, 0, 300 * time.Second},
+		{config.Feed{URL: "http://feed5.com"}, 0, 30, 300 * time.Second},
+	}
+
+	for idx, test := range tests {
+
+		scheduler := NewScheduler(300, test.jitter)
+		feeds := []config.Feed{test.feed}
+
+		if due := scheduler.Due(feeds, now); len(due) != 1 {
+			t.Errorf("Test %v Failed: feed not due before first poll", idx)
+		}
+
+		scheduler.SetTTL(test.feed.URL, test.ttl)
+		scheduler.Done(feeds, now)
+
+		next := scheduler.Next(feeds).Sub(now)
+		maxNext := test.expected + time.Duration(test.jitter)*time.Second
+
+		if next < test.expected || next > maxNext {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v to %v", idx, next, test.expected, maxNext)
+		}
+
+		if due := scheduler.Due(feeds, now.Add(next-time.Second)); len(due) != 0 {
+			t.Errorf("Test %v Failed: feed due before its interval", idx)
+		}
+
+		if due := scheduler.Due(feeds, now.Add(next)); len(due) != 1 {
+			t.Errorf("Test %v Failed: feed not due after its interval", idx)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/whatust/transmission-rss/release"
+)
+
+// isPathTemplate returns true when the download path uses template actions
+func isPathTemplate(downloadPath string) bool {
+	return strings.Contains(downloadPath, "{{")
+}
+
+// parsePathTemplate compiles a download path template, unknown fields are errors
+func parsePathTemplate(downloadPath string) (*template.Template, error) {
+	return template.New("downloadPath").Option("missingkey=error").Parse(downloadPath)
+}
+
+// sanitizePathElement removes from a template value the characters that
+// would create new directories or are not allowed in file names
+func sanitizePathElement(value string) string {
+
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, value)
+
+	return strings.Trim(value, " .")
+}
+
+// feedName returns the configured feed name or the host of its URL
+func feedName(name string, feedURL string) string {
+
+	if len(name) != 0 {
+		return name
+	}
+
+	u, err := url.Parse(feedURL)
+	if err != nil || len(u.Host) == 0 {
+		return feedURL
+	}
+
+	return u.Host
+}
+
+// releaseData returns the fields parsed from the release title, numbers are
+// kept as integers so they can be formatted by the template
+func releaseData(r release.Release) map[string]interface{} {
+
+	return map[string]interface{}{
+		"group":      sanitizePathElement(r.Group),
+		"show":       sanitizePathElement(r.Show),
+		"season":     r.Season,
+		"episode":    r.Episode,
+		"episodeEnd": r.EpisodeEnd,
+		"resolution": r.Resolution,
+		"source":     r.Source,
+		"codec":      r.Codec,
+		"audio":      r.Audio,
+		"language":   sanitizePathElement(strings.Join(r.Languages, ",")),
+		"batch":      r.Batch,
+		"version":    r.Version,
+		"proper":     r.Proper,
+	}
+}
+
+// pathData builds the values available to the download path template
+func pathData(item FeedItem, feed string, re *regexp.Regexp) map[string]interface{} {
+
+	date := item.Published
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var category string
+	if len(item.Categories) != 0 {
+		category = item.Categories[0]
+	}
+
+	data := map[string]interface{}{
+		"title":    sanitizePathElement(item.Title),
+		"feed":     sanitizePathElement(feed),
+		"category": sanitizePathElement(category),
+		"date":     date,
+		"year":     strconv.Itoa(date.Year()),
+		"month":    fmt.Sprintf("%02d", date.Month()),
+		"day":      fmt.Sprintf("%02d", date.Day()),
+		"release":  releaseData(release.Parse(item.Title)),
+	}
+
+	var groups []string
+
+	match := re.FindStringSubmatch(item.Title)
+	for i, value := range match {
+
+		value = sanitizePathElement(value)
+		groups = append(groups, value)
+
+		if name := re.SubexpNames()[i]; len(name) != 0 {
+			data[name] = value
+		}
+	}
+	data["groups"] = groups
+
+	return data
+}
+
+// ResolvePath returns the download path of the item executing the path
+// template with the capture groups of the matcher regexp and the item fields
+func (filter *Filter) ResolvePath(item FeedItem, feed string) (string, error) {
+
+	if filter.PathTemplate == nil {
+		return filter.DownloadPath, nil
+	}
+
+	var buffer bytes.Buffer
+
+	err := filter.PathTemplate.Execute(&buffer, pathData(item, feed, filter.RegExp))
+	if err != nil {
+		return "", err
+	}
+
+	downloadPath := path.Clean(buffer.String())
+	if !path.IsAbs(downloadPath) {
+		return "", fmt.Errorf("Download path is not absolute: %v", downloadPath)
+	}
+
+	return downloadPath, nil
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestResolvePath(t *testing.T) {
+
+	var tests = []struct {
+		regexp       string
+		downloadPath string
+		item         FeedItem
+		expected     string
+		hasError     bool
+	}{
+		{
+			"Show",
+			"/media/tv",
+			FeedItem{Title: "Show - 01"},
+			"/media/tv",
+			false,
+		},
+		{
+			`^\[\w+\] (?P<show>.+) S(?P<season>\d+)E\d+`,
+			"/media/tv/{{.show}}/Season {{.season}}",
+			FeedItem{Title: "[Group] Show Name S02E05 [1080p]"},
+			"/media/tv/Show Name/Season 02",
+			false,
+		},
+		{
+			`^(.+) - (\d+)`,
+			`/media/{{.feed}}/{{index .groups 1}}`,
+			FeedItem{Title: "Show Name - 12"},
+			"/media/feed/Show Name",
+			false,
+		},
+		{
+			"Show",
+			"/media/{{.category}}/{{.year}}-{{.month}}",
+			FeedItem{
+				Title:      "Show",
+				Categories: []string{"Anime"},
+				Published:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			"/media/Anime/2000-01",
+			false,
+		},
+		{
+			`^(?P<show>.+) - \d+`,
+			"/media/tv/{{.show}}",
+			FeedItem{Title: "../../etc/passwd - 01"},
+			"/media/tv/_.._etc_passwd",
+			false,
+		},
+		{
+			"Show",
+			`/media/tv/{{.release.show}}/Season {{printf "%02d" .release.season}}/{{.release.resolution}}`,
+			FeedItem{Title: "Show.Name.S02E05.1080p.WEB.H264-GROUP"},
+			"/media/tv/Show Name/Season 02/1080p",
+			false,
+		},
+		{
+			"Show",
+			"/media/anime/{{.release.group}}/{{.release.show}}",
+			FeedItem{Title: "[Sub/Group] Show: Name - 05 [720p]"},
+			"/media/anime/Sub_Group/Show_ Name",
+			false,
+		},
+		{
+			`^(?P<show>.+) - \d+`,
+			"/media/tv/{{.shw}}",
+			FeedItem{Title: "Show - 01"},
+			"",
+			true,
+		},
+		{
+			`^(?P<show>.+) - \d+`,
+			"{{.show}}",
+			FeedItem{Title: "Show - 01"},
+			"",
+			true,
+		},
+	}
+
+	for idx, test := range tests {
+
+		filter := Filter{
+			RegExp:       regexp.MustCompile(test.regexp),
+			DownloadPath: test.downloadPath,
+		}
+
+		if isPathTemplate(test.downloadPath) {
+			filter.PathTemplate, _ = parsePathTemplate(test.downloadPath)
+		}
+
+		downloadPath, err := filter.ResolvePath(test.item, "feed")
+
+		if (err != nil) != test.hasError {
+			t.Errorf("Test %v Failed: unexpected error %v", idx, err)
+		}
+
+		if downloadPath != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, downloadPath, test.expected)
+		}
+	}
+}
+
+func TestFeedName(t *testing.T) {
+
+	var tests = []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"name", "https://feed.com/rss", "name"},
+		{"", "https://feed.com/rss", "feed.com"},
+		{"", "feed", "feed"},
+	}
+
+	for idx, test := range tests {
+		if name := feedName(test.name, test.url); name != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, name, test.expected)
+		}
+	}
+}
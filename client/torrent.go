@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/whatust/transmission-rss/logger"
 )
@@ -49,3 +51,30 @@ func getTorrent(link string, clt Client, torrentFilename string) error {
 	logger.Debug("Retriving torrent:\n %v\n", resp)
 	return nil
 }
+
+// isMagnet returns true when the link is a magnet URI
+func isMagnet(link string) bool {
+	return strings.HasPrefix(strings.ToLower(link), "magnet:")
+}
+
+// magnetLink builds a magnet URI from the torrent info hash, the name and
+// tracker announce URLs are optional
+func magnetLink(infoHash string, name string, trackers []string) string {
+
+	if len(infoHash) == 0 {
+		return ""
+	}
+
+	// Transmission expects the exact topic, it must not be escaped
+	link := "magnet:?xt=urn:btih:" + strings.ToLower(infoHash)
+
+	if len(name) != 0 {
+		link += "&dn=" + url.QueryEscape(name)
+	}
+
+	for _, tracker := range trackers {
+		link += "&tr=" + url.QueryEscape(tracker)
+	}
+
+	return link
+}
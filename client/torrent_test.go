@@ -53,3 +53,35 @@ func TestGetTorrent(t *testing.T) {
 		}
 	}
 }
+
+func TestMagnetLink(t *testing.T) {
+
+	var tests = []struct {
+		infoHash string
+		name     string
+		trackers []string
+		expected string
+	}{
+		{"", "title", nil, ""},
+		{"1234567890ABCDEF1234567890ABCDEF12345678", "", nil, "magnet:?xt=urn:btih:1234567890abcdef1234567890abcdef12345678"},
+		{
+			"1234567890abcdef1234567890abcdef12345678",
+			"title 1",
+			[]string{"http://tracker.com/announce", "udp://tracker.org:1337"},
+			"magnet:?xt=urn:btih:1234567890abcdef1234567890abcdef12345678&dn=title+1&tr=http%3A%2F%2Ftracker.com%2Fannounce&tr=udp%3A%2F%2Ftracker.org%3A1337",
+		},
+	}
+
+	for idx, test := range tests {
+
+		link := magnetLink(test.infoHash, test.name, test.trackers)
+
+		if link != test.expected {
+			t.Errorf("Test %v Failed:\ngot      %v\nexpected %v", idx, link, test.expected)
+		}
+
+		if len(link) != 0 && !isMagnet(link) {
+			t.Errorf("Test %v Failed: %v not detected as magnet", idx, link)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/whatust/transmission-rss/config"
+	"github.com/whatust/transmission-rss/logger"
+)
+
+// magnetHash returns the lowercase info hash of a magnet URI, empty when the
+// link is not a magnet or has no BitTorrent topic
+func magnetHash(link string) string {
+
+	if !isMagnet(link) {
+		return ""
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	for _, topic := range u.Query()["xt"] {
+		if strings.HasPrefix(strings.ToLower(topic), "urn:btih:") {
+			return strings.ToLower(topic[len("urn:btih:"):])
+		}
+	}
+
+	return ""
+}
+
+// uidField returns the value of a unique ID field of the item
+func uidField(item FeedItem, field string) string {
+
+	switch field {
+	case "guid":
+		return item.GUID
+	case "infoHash":
+		if len(item.InfoHash) != 0 {
+			return strings.ToLower(item.InfoHash)
+		}
+		if hash := magnetHash(item.MagnetURL); len(hash) != 0 {
+			return hash
+		}
+		return magnetHash(item.TorrentLink())
+	case "link":
+		return item.TorrentLink()
+	case "title":
+		return item.Title
+	}
+
+	return ""
+}
+
+// itemUID returns the key of the item in the seen store, built from the
+// fields of the strategy joined by "+" and prefixed by the strategy. Titles
+// are kept unprefixed so seen files keyed on titles stay valid and items
+// missing one of the fields fall back to their title
+func itemUID(item FeedItem, strategy string) string {
+
+	if len(strategy) == 0 || strategy == "title" {
+		return item.Title
+	}
+
+	var values []string
+
+	for _, field := range strings.Split(strategy, "+") {
+
+		value := uidField(item, field)
+		if len(value) == 0 {
+			logger.Debug("Item without %v, using title as unique ID: %v\n", field, item.Title)
+			return item.Title
+		}
+		values = append(values, value)
+	}
+
+	return strategy + ":" + strings.Join(values, "|")
+}
+
+// uidStrategy returns the unique ID strategy of the feed, the global one when
+// the feed sets none
+func (c TransmissionClient) uidStrategy(feed config.Feed) string {
+
+	if len(feed.UID) != 0 {
+		return feed.UID
+	}
+
+	return c.UID
+}
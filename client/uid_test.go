@@ -0,0 +1,121 @@
+package client
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/whatust/transmission-rss/config"
+	"github.com/whatust/transmission-rss/helper"
+)
+
+func TestMagnetHash(t *testing.T) {
+
+	var tests = []struct {
+		link     string
+		expected string
+	}{
+		{"magnet:?xt=urn:btih:1234567890ABCDEF1234567890ABCDEF12345678&dn=title", "1234567890abcdef1234567890abcdef12345678"},
+		{"magnet:?dn=title&xt=urn:btih:hash", "hash"},
+		{"magnet:?xt=urn:sha1:hash", ""},
+		{"http://example.com/file.torrent", ""},
+		{"", ""},
+	}
+
+	for idx, test := range tests {
+		if hash := magnetHash(test.link); hash != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, hash, test.expected)
+		}
+	}
+}
+
+func TestItemUID(t *testing.T) {
+
+	item := FeedItem{
+		Title:    "Show - 01",
+		Link:     "http://example.com/1.torrent",
+		GUID:     "http://example.com/details/1",
+		InfoHash: "1234567890ABCDEF1234567890ABCDEF12345678",
+	}
+
+	var tests = []struct {
+		item     FeedItem
+		strategy string
+		expected string
+	}{
+		{item, "", "Show - 01"},
+		{item, "title", "Show - 01"},
+		{item, "guid", "guid:http://example.com/details/1"},
+		{item, "infoHash", "infoHash:1234567890abcdef1234567890abcdef12345678"},
+		{item, "link", "link:http://example.com/1.torrent"},
+		{item, "guid+title", "guid+title:http://example.com/details/1|Show - 01"},
+		{
+			FeedItem{Title: "Show - 01", Link: "magnet:?xt=urn:btih:ABCDEF&dn=Show"},
+			"infoHash",
+			"infoHash:abcdef",
+		},
+		{FeedItem{Title: "Show - 01", Link: "http://example.com/1.torrent"}, "guid", "Show - 01"},
+		{FeedItem{Title: "Show - 01", GUID: "1"}, "guid+infoHash", "Show - 01"},
+	}
+
+	for idx, test := range tests {
+		if uid := itemUID(test.item, test.strategy); uid != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, uid, test.expected)
+		}
+	}
+}
+
+func TestProcessItemUID(t *testing.T) {
+
+	var tests = []struct {
+		global   string
+		feed     string
+		seen     []helper.SeenEntry
+		item     FeedItem
+		expected string
+	}{
+		{"", "", nil, FeedItem{Title: "Show - 01", GUID: "1"}, "Show - 01"},
+		{"guid", "", nil, FeedItem{Title: "Show - 01", GUID: "1"}, "guid:1"},
+		{"title", "guid", nil, FeedItem{Title: "Show - 01", GUID: "1"}, "guid:1"},
+		{"guid", "", []helper.SeenEntry{{UID: "guid:1"}}, FeedItem{Title: "Show - 01", GUID: "1"}, ""},
+		{"guid", "", []helper.SeenEntry{{UID: "guid:1"}}, FeedItem{Title: "Show - 01", GUID: "2"}, "guid:2"},
+		// Items of legacy seen files stay seen
+		{"guid", "", []helper.SeenEntry{{UID: "Show - 01", Legacy: true}}, FeedItem{Title: "Show - 01", GUID: "1"}, ""},
+		// Other items keyed by the same title are not duplicates
+		{"guid", "", []helper.SeenEntry{{UID: "Show - 01"}}, FeedItem{Title: "Show - 01", GUID: "1"}, "guid:1"},
+	}
+
+	filter := &Filter{
+		RegExp:       regexp.MustCompile("Show"),
+		DownloadPath: "/downloads",
+	}
+
+	for idx, test := range tests {
+
+		client := TransmissionClient{UID: test.global}
+
+		seen := helper.SeenSet{
+			Old: make(map[string]helper.SeenEntry),
+			New: make(map[string]helper.SeenEntry),
+		}
+		for _, entry := range test.seen {
+			seen.AddSeen(entry)
+		}
+
+		test.item.Link = "http://example.com/" + test.item.GUID
+
+		channel := make(chan TorrentReq, 1)
+
+		wg.Add(1)
+		client.processItem(test.item, config.Feed{URL: "http://feed.com", UID: test.feed}, "Show", filter, channel, &seen)
+		close(channel)
+
+		var uid string
+		for req := range channel {
+			uid = req.UID
+		}
+
+		if uid != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %q\nExpected: %q", idx, uid, test.expected)
+		}
+	}
+}
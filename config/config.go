@@ -1,11 +1,5 @@
 package config
 
-import (
-	"os"
-
-	"gopkg.in/yaml.v2"
-)
-
 // Server struct used to parse yaml file
 type Server struct {
 	Host     string `yaml:"host"`
@@ -46,15 +40,23 @@ type Creds struct {
 
 // Config struct used to parse yaml file
 type Config struct {
-	Server      Server  `yaml:"server"`
-	Log         Log     `yaml:"log"`
-	Creds       Creds   `yaml:"login"`
-	Connect     Connect `yaml:"connection"`
-	SeenFile    string  `yaml:"seenFile"`
-	RSSFile     string  `yaml:"rssFile"`
-	TorrentPath string  `yaml:"torrentPath"`
-	Proxy       string  `yaml:"proxy"`
-	//UIDType  string  `yaml:"uID"`
+	Server        Server   `yaml:"server"`
+	Log           Log      `yaml:"log"`
+	Creds         Creds    `yaml:"login"`
+	Connect       Connect  `yaml:"connection"`
+	SeenFile      string   `yaml:"seenFile"`
+	SeenRetention Duration `yaml:"seenRetention"`
+	RSSFile       string   `yaml:"rssFile"`
+	CacheFile     string   `yaml:"cacheFile"`
+	HistoryFile   string   `yaml:"historyFile"`
+	TorrentPath   string   `yaml:"torrentPath"`
+	Proxy         string   `yaml:"proxy"`
+	Interval      int      `yaml:"interval"`
+	Jitter        int      `yaml:"jitter"`
+	Defaults      Defaults `yaml:"defaults"`
+	UID           string   `yaml:"uid"`
+	State         string   `yaml:"state"`
+	StateFile     string   `yaml:"stateFile"`
 	//SaveTorrent bool    `yaml:"saveTorrent"`
 }
 
@@ -87,75 +89,125 @@ func NewConfig() Config {
 			Compress:   false,
 			LogPath:    "/var/log/transmission-rss-log.log",
 		},
-		SeenFile: "/etc/transmission-rss-seen.log",
-		RSSFile:  "/etc/transmission-rss-feeds.yml",
+		SeenFile:    "/etc/transmission-rss-seen.log",
+		RSSFile:     "/etc/transmission-rss-feeds.yml",
+		CacheFile:   "/etc/transmission-rss-cache.json",
+		HistoryFile: "/etc/transmission-rss-history.json",
+		Interval:    300,
+		Jitter:      0,
+		UID:         "title",
+		State:       "file",
+		StateFile:   "/etc/transmission-rss.db",
 	}
 	return config
 }
 
-// GetConfig parse config file for transmission-rss
-func GetConfig(configFilename string) (*Config, error) {
+// AddOptions struct used to parse yaml file, unset values keep the
+// Transmission defaults except paused which defaults to true
+type AddOptions struct {
+	Paused            *bool    `yaml:"paused"`
+	BandwidthPriority *int     `yaml:"bandwidthPriority"`
+	PeerLimit         *int     `yaml:"peerLimit"`
+	Labels            []string `yaml:"labels"`
+	QueuePosition     *int     `yaml:"queuePosition"`
+}
+
+// Defaults struct used to parse yaml file, values inherited by the matchers
+// that do not set them, feed defaults take precedence over global ones
+type Defaults struct {
+	DownloadPath string `yaml:"downloadPath"`
+	IgnoreRemake *bool  `yaml:"ignoreRemake"`
+	OnlyTrusted  *bool  `yaml:"onlyTrusted"`
+	AddOptions   `yaml:",inline"`
+}
 
-	configFile, err := os.OpenFile(configFilename, os.O_RDONLY, 0644)
+// withDefaults returns the options filling the unset values from defaults
+func (opts AddOptions) withDefaults(defaults AddOptions) AddOptions {
 
-	if err != nil {
-		return nil, err
+	if opts.Paused == nil {
+		opts.Paused = defaults.Paused
 	}
-	defer configFile.Close()
+	if opts.BandwidthPriority == nil {
+		opts.BandwidthPriority = defaults.BandwidthPriority
+	}
+	if opts.PeerLimit == nil {
+		opts.PeerLimit = defaults.PeerLimit
+	}
+	if opts.Labels == nil {
+		opts.Labels = defaults.Labels
+	}
+	if opts.QueuePosition == nil {
+		opts.QueuePosition = defaults.QueuePosition
+	}
+
+	return opts
+}
 
-	config := NewConfig()
-	decoder := yaml.NewDecoder(configFile)
-	err = decoder.Decode(&config)
+// WithDefaults returns the matcher filling the unset values from defaults
+func (matcher Matcher) WithDefaults(defaults Defaults) Matcher {
 
-	if err != nil {
-		return nil, err
+	if len(matcher.DownloadPath) == 0 {
+		matcher.DownloadPath = defaults.DownloadPath
 	}
+	if matcher.IgnoreRemake == nil {
+		matcher.IgnoreRemake = defaults.IgnoreRemake
+	}
+	if matcher.OnlyTrusted == nil {
+		matcher.OnlyTrusted = defaults.OnlyTrusted
+	}
+	matcher.AddOptions = matcher.AddOptions.withDefaults(defaults.AddOptions)
 
-	return &config, nil
+	return matcher
 }
 
 // Matcher struct used to parse yaml file
 type Matcher struct {
 	RegExp       string `yaml:"regexp"`
 	DownloadPath string `yaml:"downloadPath"`
-	IgnoreRemake bool   `yaml:"ignoreRemake"`
-	OnlyTrusted  bool   `yaml:"onlyTrusted"`
+	IgnoreRemake *bool  `yaml:"ignoreRemake"`
+	OnlyTrusted  *bool  `yaml:"onlyTrusted"`
+	AddOptions   `yaml:",inline"`
+	// Torznab filters, attributes maps attribute names to regexps
+	OnlyFreeleech bool              `yaml:"onlyFreeleech"`
+	Attributes    map[string]string `yaml:"attributes"`
+	// Extra regexps the title must all match and must not match
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+	// Item metadata filters, unknown values are not filtered
+	MinSize    Size     `yaml:"minSize"`
+	MaxSize    Size     `yaml:"maxSize"`
+	MinSeeders int      `yaml:"minSeeders"`
+	MaxAge     Duration `yaml:"maxAge"`
+	Categories []string `yaml:"categories"`
+	// Fields parsed from the release title mapped to regexps
+	Release map[string]string `yaml:"release"`
+	// Episode tracking skips other releases of grabbed episodes, upgrades
+	// lists the releases allowed to replace them
+	Episodes bool     `yaml:"episodes"`
+	Upgrades []string `yaml:"upgrades"`
+	// Resolutions from best to worst, quality upgrades stop at the cutoff and
+	// the releases of an episode seen during wait are compared
+	Qualities []string `yaml:"qualities"`
+	Cutoff    string   `yaml:"cutoff"`
+	Wait      Duration `yaml:"wait"`
 }
 
 // Feed strcut used to parse yaml file
 type Feed struct {
-	URL                 string    `yaml:"url"`
-	//DefaultDownloadPath string    `yaml:"defaultDownloadPath"`
-	//DefaultIgnoreRemake string    `yaml:"defaultIgnoreRemake"`
-	//DefaultValidateCert string    `yaml:"defaultValidateCert"`
-	SeedRatioLimit      int       `yaml:"seedRationLimit"`
-	Matchers            []Matcher `yaml:"matchers"`
-	Proxy               string    `yaml:"proxy"`
-	ValidateCert        bool      `yaml:"validateCert"`
+	URL            string    `yaml:"url"`
+	Name           string    `yaml:"name"`
+	Defaults       Defaults  `yaml:"defaults"`
+	SeedRatioLimit float64   `yaml:"seedRationLimit"`
+	SeedIdleLimit  int       `yaml:"seedIdleLimit"`
+	Matchers       []Matcher `yaml:"matchers"`
+	Proxy          string    `yaml:"proxy"`
+	ValidateCert   bool      `yaml:"validateCert"`
+	Interval       int       `yaml:"interval"`
+	Trackers       []string  `yaml:"trackers"`
+	UID            string    `yaml:"uid"`
 }
 
 // FeedConfig struct used to parse yaml file
 type FeedConfig struct {
 	Feeds []Feed
 }
-
-// GetFeedsConfig parse feed file for transmission-rss
-func GetFeedsConfig(RSSFilename string) (*FeedConfig, error) {
-
-	rssFile, err := os.OpenFile(RSSFilename, os.O_RDONLY, 0644)
-
-	if err != nil {
-		return nil, err
-	}
-	defer rssFile.Close()
-
-	var rssFeed FeedConfig
-	decoder := yaml.NewDecoder(rssFile)
-	err = decoder.Decode(&rssFeed)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &rssFeed, nil
-}
@@ -4,9 +4,10 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
-func TestGetConfig(t *testing.T) {
+func TestDecodeConfig(t *testing.T) {
 
 	var tests = []struct {
 		filename    string
@@ -48,32 +49,42 @@ func TestGetConfig(t *testing.T) {
 				},
 				SeenFile:    "/etc/transmission-rss-seen.log",
 				RSSFile:     "/etc/transmission-rss-feeds.yml",
+				CacheFile:   "/etc/transmission-rss-cache.json",
+				HistoryFile: "/etc/transmission-rss-history.json",
 				TorrentPath: "",
+				Interval:    300,
+				UID:         "title",
+				State:       "file",
+				StateFile:   "/etc/transmission-rss.db",
 			},
 			nil,
 		},
 	}
 
 	for idx, test := range tests {
-		config, err := GetConfig(test.filename)
+		config := NewConfig()
+		_, errs := decodeStrict(test.filename, &config)
 
-		if config != nil {
-			if !reflect.DeepEqual(config, test.expected) {
+		if len(errs) == 0 {
+			if !reflect.DeepEqual(&config, test.expected) {
 				t.Errorf("Test %v Failed: Configs do not match for file %v", idx, test.filename)
 			}
 		} else {
-			if config != test.expected {
+			if test.expected != nil {
 				t.Errorf("test %v Failed: Config returned nil expected config", idx)
 			}
 		}
 
-		if (err == nil) != (test.expectedErr == nil) {
-			t.Errorf("Test %v Failed: Errors do not match %v, expected %v", idx, err, test.expectedErr)
+		if (len(errs) == 0) != (test.expectedErr == nil) {
+			t.Errorf("Test %v Failed: Errors do not match %v, expected %v", idx, errs, test.expectedErr)
 		}
 	}
 }
 
-func TestGetFeedsConfig(t *testing.T) {
+func TestDecodeFeedsConfig(t *testing.T) {
+
+	yes, no := true, false
+	paused, priority, peers, position := false, 1, 50, 0
 
 	var tests = []struct {
 		filename    string
@@ -92,20 +103,17 @@ func TestGetFeedsConfig(t *testing.T) {
 							{
 								RegExp:       "regexp0",
 								DownloadPath: "/var/lib/transmission-daemon/downloads",
-								IgnoreRemake: true,
-								OnlyTrusted:  true,
+								IgnoreRemake: &yes,
+								OnlyTrusted:  &yes,
 							},
 							{
 								RegExp:       "regexp1",
 								DownloadPath: "/var/lib/transmission-daemon/downloads",
-								IgnoreRemake: false,
-								OnlyTrusted:  true,
+								OnlyTrusted:  &yes,
 							},
 							{
 								RegExp:       "regexp2",
 								DownloadPath: "/var/lib/transmission-daemon/downloads",
-								IgnoreRemake: false,
-								OnlyTrusted:  false,
 							},
 						},
 						Proxy:        "",
@@ -118,8 +126,7 @@ func TestGetFeedsConfig(t *testing.T) {
 							{
 								RegExp:       "regexp3",
 								DownloadPath: "/var/lib/transmission-daemon/downloads",
-								IgnoreRemake: true,
-								OnlyTrusted:  false,
+								IgnoreRemake: &yes,
 							},
 						},
 						Proxy:        "http://localhost:8080",
@@ -129,27 +136,461 @@ func TestGetFeedsConfig(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"../test/feed/options.yml",
+			&FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "https:feed1.com",
+						Matchers: []Matcher{
+							{
+								RegExp:       "regexp0",
+								DownloadPath: "/var/lib/transmission-daemon/downloads",
+								AddOptions: AddOptions{
+									Paused:            &paused,
+									BandwidthPriority: &priority,
+									PeerLimit:         &peers,
+									Labels:            []string{"tv", "anime"},
+									QueuePosition:     &position,
+								},
+							},
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			"../test/feed/filters.yml",
+			&FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "https:feed1.com",
+						Matchers: []Matcher{
+							{
+								RegExp:       "regexp0",
+								DownloadPath: "/var/lib/transmission-daemon/downloads",
+								MinSize:      500 * 1024 * 1024,
+								MaxSize:      1610612736,
+								MinSeeders:   5,
+								MaxAge:       Duration(7 * 24 * time.Hour),
+								Categories:   []string{"Anime - English-translated"},
+							},
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			"../test/feed/defaults.yml",
+			&FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "https:feed1.com",
+						Defaults: Defaults{
+							DownloadPath: "/var/lib/transmission-daemon/downloads",
+							IgnoreRemake: &yes,
+							AddOptions: AddOptions{
+								Labels: []string{"anime"},
+							},
+						},
+						Matchers: []Matcher{
+							{
+								RegExp: "regexp0",
+							},
+							{
+								RegExp:       "regexp1",
+								DownloadPath: "/var/lib/transmission-daemon/other",
+								IgnoreRemake: &no,
+							},
+						},
+					},
+				},
+			},
+			nil,
+		},
 	}
 
 	for idx, test := range tests {
 
-		feed, err := GetFeedsConfig(test.filename)
+		var feed FeedConfig
+		_, errs := decodeStrict(test.filename, &feed)
 
-		fmt.Printf("Feed: %v\n", feed)
-		fmt.Printf("Test: %v\n", test.expected)
-
-		if feed != nil {
-			if !reflect.DeepEqual(feed, test.expected) {
-				t.Errorf("Test %v Failed: GetFeedsConfig do not match for file %v", idx, test.filename)
+		if len(errs) == 0 {
+			if !reflect.DeepEqual(&feed, test.expected) {
+				t.Errorf("Test %v Failed: Feeds do not match for file %v", idx, test.filename)
 			}
 		} else {
-			if feed != test.expected {
-				t.Errorf("Test %v Failed: GetFeedsConfig returned nil expected feed", idx)
+			if test.expected != nil {
+				t.Errorf("Test %v Failed: Feeds returned nil expected feed", idx)
 			}
 		}
 
-		if (err == nil) != (test.expectedErr == nil) {
-			t.Errorf("Test %v Failed: Errors do not match %v, expected %v", idx, err, test.expectedErr)
+		if (len(errs) == 0) != (test.expectedErr == nil) {
+			t.Errorf("Test %v Failed: Errors do not match %v, expected %v", idx, errs, test.expectedErr)
+		}
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+
+	yes, no := true, false
+	paused, priority := false, 1
+
+	feed := Defaults{
+		DownloadPath: "/feed",
+		IgnoreRemake: &yes,
+	}
+	global := Defaults{
+		DownloadPath: "/global",
+		IgnoreRemake: &no,
+		OnlyTrusted:  &yes,
+		AddOptions: AddOptions{
+			Paused: &paused,
+			Labels: []string{"global"},
+		},
+	}
+
+	var tests = []struct {
+		matcher  Matcher
+		expected Matcher
+	}{
+		{
+			Matcher{RegExp: "regexp"},
+			Matcher{
+				RegExp:       "regexp",
+				DownloadPath: "/feed",
+				IgnoreRemake: &yes,
+				OnlyTrusted:  &yes,
+				AddOptions: AddOptions{
+					Paused: &paused,
+					Labels: []string{"global"},
+				},
+			},
+		},
+		{
+			Matcher{
+				RegExp:       "regexp",
+				DownloadPath: "/matcher",
+				IgnoreRemake: &no,
+				OnlyTrusted:  &no,
+				AddOptions: AddOptions{
+					BandwidthPriority: &priority,
+					Labels:            []string{},
+				},
+			},
+			Matcher{
+				RegExp:       "regexp",
+				DownloadPath: "/matcher",
+				IgnoreRemake: &no,
+				OnlyTrusted:  &no,
+				AddOptions: AddOptions{
+					Paused:            &paused,
+					BandwidthPriority: &priority,
+					Labels:            []string{},
+				},
+			},
+		},
+	}
+
+	for idx, test := range tests {
+
+		matcher := test.matcher.WithDefaults(feed).WithDefaults(global)
+
+		if !reflect.DeepEqual(matcher, test.expected) {
+			t.Errorf("Test %v Failed:\nGot:      %+v\nExpected: %+v", idx, matcher, test.expected)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	outOfRange := 2
+
+	badUID := NewConfig()
+	badUID.UID = "guid+hash"
+
+	badState := NewConfig()
+	badState.State = "sqlite"
+
+	boltState := NewConfig()
+	boltState.State = "bolt"
+
+	var tests = []struct {
+		config      Config
+		feeds       FeedConfig
+		expectedErr error
+	}{
+		{NewConfig(), FeedConfig{}, nil},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "http://feed.com",
+						Matchers: []Matcher{
+							{RegExp: "regexp", DownloadPath: "/downloads"},
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{Config{}, FeedConfig{}, fmt.Errorf("Invalid config")},
+		{badState, FeedConfig{}, fmt.Errorf("Invalid config")},
+		{boltState, FeedConfig{}, nil},
+		{
+			badUID,
+			FeedConfig{},
+			fmt.Errorf("Invalid config"),
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "http://feed.com",
+						UID: "infoHash+title",
+						Matchers: []Matcher{
+							{RegExp: "regexp", DownloadPath: "/downloads"},
+						},
+					},
+					{
+						URL: "http://feed.org",
+						UID: "guid,title",
+						Matchers: []Matcher{
+							{RegExp: "regexp", DownloadPath: "/downloads"},
+						},
+					},
+				},
+			},
+			fmt.Errorf("Invalid feed list"),
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "http://feed.com",
+						Matchers: []Matcher{
+							{RegExp: "regexp(", DownloadPath: "/downloads"},
+						},
+					},
+				},
+			},
+			fmt.Errorf("Invalid feed list"),
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						Matchers: []Matcher{
+							{RegExp: "regexp"},
+						},
+					},
+				},
+			},
+			fmt.Errorf("Invalid feed list"),
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "http://feed.com",
+						Matchers: []Matcher{
+							{
+								RegExp:       "regexp",
+								DownloadPath: "/downloads",
+								AddOptions: AddOptions{
+									BandwidthPriority: &outOfRange,
+									Labels:            []string{"a,b"},
+								},
+							},
+						},
+					},
+				},
+			},
+			fmt.Errorf("Invalid feed list"),
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "http://feed.com",
+						Matchers: []Matcher{
+							{
+								RegExp:    "regexp",
+								Qualities: []string{"1080p", "720p"},
+								Cutoff:    "480p",
+							},
+						},
+					},
+				},
+			},
+			fmt.Errorf("Invalid feed list"),
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "http://feed.com",
+						Matchers: []Matcher{
+							{
+								RegExp:       "regexp",
+								DownloadPath: "/downloads",
+								Release:      map[string]string{"quality": "1080p"},
+							},
+						},
+					},
+				},
+			},
+			fmt.Errorf("Invalid feed list"),
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "http://feed.com",
+						Matchers: []Matcher{
+							{
+								RegExp:       "regexp",
+								DownloadPath: "/downloads",
+								Release:      map[string]string{"resolution": "1080p|720p", "group": "^SubsPlease$"},
+							},
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL: "http://feed.com",
+						Matchers: []Matcher{
+							{
+								RegExp:    "regexp",
+								Episodes:  true,
+								Upgrades:  []string{"version", "proper", "quality"},
+								Qualities: []string{"1080p", "720p"},
+								Cutoff:    "1080p",
+								Wait:      Duration(15 * time.Minute),
+							},
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL:      "http://feed.com",
+						Defaults: Defaults{DownloadPath: ""},
+						Matchers: []Matcher{
+							{
+								RegExp:       `^(?P<show>.+) - \d+`,
+								DownloadPath: "/media/{{.show}}/{{.release.season}}/{{index .groups 1}}",
+							},
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL:      "http://feed.com",
+						Defaults: Defaults{DownloadPath: ""},
+						Matchers: []Matcher{
+							{
+								RegExp:       `^(?P<show>.+) - \d+`,
+								DownloadPath: "/media/{{.shw}}",
+							},
+						},
+					},
+				},
+			},
+			fmt.Errorf("Invalid feed list"),
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL:      "http://feed.com",
+						Defaults: Defaults{DownloadPath: ""},
+						Matchers: []Matcher{
+							{
+								RegExp:       `^(?P<show>.+) - \d+`,
+								DownloadPath: "/media/{{.release.sesaon}}",
+							},
+						},
+					},
+				},
+			},
+			fmt.Errorf("Invalid feed list"),
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL:      "http://feed.com",
+						Defaults: Defaults{DownloadPath: "/media/{{.feed}}/{{.shw}}"},
+						Matchers: []Matcher{
+							{
+								RegExp:       `^(?P<show>.+) - \d+`,
+								DownloadPath: "",
+							},
+						},
+					},
+				},
+			},
+			fmt.Errorf("Invalid feed list"),
+		},
+		{
+			NewConfig(),
+			FeedConfig{
+				Feeds: []Feed{
+					{
+						URL:      "http://feed.com",
+						Defaults: Defaults{DownloadPath: ""},
+						Matchers: []Matcher{
+							{
+								RegExp:       `^(?P<show>.+) - \d+`,
+								DownloadPath: "/media/{{range .groups}}{{.}}{{end}}/{{.date.Year}}",
+							},
+						},
+					},
+				},
+			},
+			nil,
+		},
+	}
+
+	for idx, test := range tests {
+
+		problems := test.config.problems()
+		if len(problems) == 0 {
+			problems = test.feeds.problems(test.config.Defaults)
+		}
+
+		if (len(problems) == 0) != (test.expectedErr == nil) {
+			t.Errorf("Test %v Failed: Errors do not match %v, expected %v", idx, problems, test.expectedErr)
 		}
 	}
 }
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// nodeError returns err as a type error so the decoder keeps its line and
+// goes on reporting the errors of the other values
+func nodeError(value *yaml.Node, err error) error {
+	return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %v: %v", value.Line, err)}}
+}
+
+var sizeRegexp = regexp.MustCompile(`^(?i)([0-9]+(?:\.[0-9]+)?)\s*([kmgtp]?)(i?)(b?)$`)
+
+// ParseSize parses sizes such as "1.5 GiB" or "700MB" into bytes, binary
+// units use powers of 1024 and decimal ones powers of 1000
+func ParseSize(value string) (int64, error) {
+
+	match := sizeRegexp.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, fmt.Errorf("Invalid size: %q", value)
+	}
+
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	base := 1000.0
+	if len(match[3]) != 0 {
+		base = 1024.0
+	}
+
+	exponent := 0
+	if len(match[2]) != 0 {
+		exponent = strings.Index("KMGTP", strings.ToUpper(match[2])) + 1
+	}
+
+	for i := 0; i < exponent; i++ {
+		number *= base
+	}
+
+	return int64(number), nil
+}
+
+// Size number of bytes parsed from human units in yaml files
+type Size int64
+
+// UnmarshalYAML parses sizes such as "1.5 GiB"
+func (size *Size) UnmarshalYAML(value *yaml.Node) error {
+
+	bytes, err := ParseSize(value.Value)
+	if err != nil {
+		return nodeError(value, err)
+	}
+
+	*size = Size(bytes)
+
+	return nil
+}
+
+// ParseDuration parses Go durations such as "36h" also accepting days as "7d"
+func ParseDuration(value string) (time.Duration, error) {
+
+	value = strings.TrimSpace(value)
+
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid duration: %q", value)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// Duration parsed from strings such as "36h" or "7d" in yaml files
+type Duration time.Duration
+
+// UnmarshalYAML parses durations such as "7d"
+func (duration *Duration) UnmarshalYAML(value *yaml.Node) error {
+
+	d, err := ParseDuration(value.Value)
+	if err != nil {
+		return nodeError(value, err)
+	}
+
+	*duration = Duration(d)
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+
+	var tests = []struct {
+		value    string
+		expected int64
+		hasError bool
+	}{
+		{"1024", 1024, false},
+		{"100.0 MiB", 104857600, false},
+		{"1.5 GiB", 1610612736, false},
+		{"700MB", 700000000, false},
+		{"2 kb", 2000, false},
+		{"1 TiB", 1099511627776, false},
+		{"", 0, true},
+		{"big", 0, true},
+		{"1.5 XB", 0, true},
+	}
+
+	for idx, test := range tests {
+
+		size, err := ParseSize(test.value)
+
+		if (err != nil) != test.hasError {
+			t.Errorf("Test %v Failed: unexpected error %v", idx, err)
+		}
+
+		if size != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, size, test.expected)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+
+	var tests = []struct {
+		value    string
+		expected time.Duration
+		hasError bool
+	}{
+		{"36h", 36 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"d", 0, true},
+		{"week", 0, true},
+	}
+
+	for idx, test := range tests {
+
+		duration, err := ParseDuration(test.value)
+
+		if (err != nil) != test.hasError {
+			t.Errorf("Test %v Failed: unexpected error %v", idx, err)
+		}
+
+		if duration != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, duration, test.expected)
+		}
+	}
+}
@@ -0,0 +1,584 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/whatust/transmission-rss/release"
+	"gopkg.in/yaml.v3"
+)
+
+// FieldError problem found in a configuration file, the line is zero when
+// the value is not in the file
+type FieldError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (err FieldError) Error() string {
+
+	if err.Line == 0 {
+		return fmt.Sprintf("%v: %v", err.File, err.Msg)
+	}
+
+	return fmt.Sprintf("%v:%v: %v", err.File, err.Line, err.Msg)
+}
+
+// ValidationError lists every problem found in the configuration files
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (err *ValidationError) Error() string {
+
+	msgs := make([]string, 0, len(err.Errors))
+	for _, e := range err.Errors {
+		msgs = append(msgs, e.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// problem invalid value at a dotted yaml path such as feeds.0.matchers.1.regexp
+type problem struct {
+	path string
+	msg  string
+}
+
+func problemf(path string, format string, args ...interface{}) problem {
+	return problem{path: path, msg: fmt.Sprintf(format, args...)}
+}
+
+var (
+	yamlLineRegexp    = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	unknownKeyRegexp  = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+	validLogLevels    = []string{"Debug", "Info", "Warning", "Error"}
+	validFeedSchemes  = []string{"http", "https"}
+	validProxySchemes = []string{"http", "https", "socks5"}
+	validUpgrades     = []string{"version", "proper", "quality"}
+	validQualities    = []string{"2160p", "1080p", "720p", "576p", "480p", "360p"}
+	validUIDFields    = []string{"guid", "infoHash", "link", "title"}
+	validStates       = []string{"file", "bolt"}
+	// pathFields item values of the download path template, the named groups
+	// of the matcher regexp are added to them
+	pathFields = []string{"title", "feed", "category", "date", "year", "month", "day", "release", "groups"}
+)
+
+// yamlErrors splits the errors of the yaml decoder by line
+func yamlErrors(filename string, err error) []FieldError {
+
+	msgs := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		msgs = typeErr.Errors
+	}
+
+	var errs []FieldError
+
+	for _, msg := range msgs {
+
+		fieldErr := FieldError{File: filename, Msg: msg}
+
+		if match := yamlLineRegexp.FindStringSubmatch(msg); match != nil {
+			fieldErr.Line, _ = strconv.Atoi(match[1])
+			fieldErr.Msg = match[2]
+		}
+		if match := unknownKeyRegexp.FindStringSubmatch(fieldErr.Msg); match != nil {
+			fieldErr.Msg = fmt.Sprintf("unknown key %v", match[1])
+		}
+
+		errs = append(errs, fieldErr)
+	}
+
+	return errs
+}
+
+// decodeStrict decodes the yaml file rejecting unknown keys, the document node
+// is returned to locate the values rejected by the validation
+func decodeStrict(filename string, out interface{}) (*yaml.Node, []FieldError) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, []FieldError{{File: filename, Msg: err.Error()}}
+	}
+
+	var node yaml.Node
+
+	err = yaml.Unmarshal(data, &node)
+	if err != nil {
+		return nil, yamlErrors(filename, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(out)
+	if err != nil && err != io.EOF {
+		return &node, yamlErrors(filename, err)
+	}
+
+	return &node, nil
+}
+
+// nodeLine returns the line of the key at path, or of its deepest parent when
+// the key is not in the file
+func nodeLine(node *yaml.Node, path string) int {
+
+	if node == nil {
+		return 0
+	}
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return 0
+		}
+		node = node.Content[0]
+	}
+
+	line := node.Line
+
+	for _, key := range strings.Split(path, ".") {
+
+		switch node.Kind {
+		case yaml.MappingNode:
+			var next *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					line = node.Content[i].Line
+					next = node.Content[i+1]
+					break
+				}
+			}
+			if next == nil {
+				return line
+			}
+			node = next
+		case yaml.SequenceNode:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(node.Content) {
+				return line
+			}
+			node = node.Content[idx]
+			line = node.Line
+		default:
+			return line
+		}
+	}
+
+	return line
+}
+
+// locate converts the problems to errors with the line of their values
+func locate(filename string, node *yaml.Node, problems []problem) []FieldError {
+
+	var errs []FieldError
+
+	for _, p := range problems {
+		errs = append(errs, FieldError{
+			File: filename,
+			Line: nodeLine(node, p.path),
+			Msg:  p.path + ": " + p.msg,
+		})
+	}
+
+	return errs
+}
+
+// LoadConfig strictly decodes and validates the config file and the feed list
+// it points to without any network activity, every problem of both files is
+// returned in a ValidationError
+func LoadConfig(configFilename string) (*Config, *FeedConfig, error) {
+
+	config := NewConfig()
+
+	node, errs := decodeStrict(configFilename, &config)
+	if node == nil {
+		return nil, nil, &ValidationError{errs}
+	}
+	errs = append(errs, locate(configFilename, node, config.problems())...)
+
+	var rssFeed FeedConfig
+
+	if len(config.RSSFile) != 0 {
+		node, feedErrs := decodeStrict(config.RSSFile, &rssFeed)
+		errs = append(errs, feedErrs...)
+		if node != nil {
+			errs = append(errs, locate(config.RSSFile, node, rssFeed.problems(config.Defaults))...)
+		}
+	}
+
+	if len(errs) != 0 {
+		return nil, nil, &ValidationError{errs}
+	}
+
+	return &config, &rssFeed, nil
+}
+
+func containString(list []string, value string) bool {
+
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkURL returns why the address is not an absolute URL with one of the schemes
+func checkURL(address string, schemes []string) string {
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return err.Error()
+	}
+	if !containString(schemes, u.Scheme) || len(u.Host) == 0 {
+		return fmt.Sprintf("invalid url %q, expected %v://host", address, strings.Join(schemes, "|"))
+	}
+
+	return ""
+}
+
+// uidProblems checks that the unique ID strategy only joins known fields with "+"
+func uidProblems(key string, uid string) []problem {
+
+	var problems []problem
+
+	for _, field := range strings.Split(uid, "+") {
+		if !containString(validUIDFields, field) {
+			problems = append(problems, problemf(key, "must be fields of %v joined by +: %q", strings.Join(validUIDFields, ", "), uid))
+			break
+		}
+	}
+
+	return problems
+}
+
+// downloadPathProblems checks that the download path is an absolute path or template
+func downloadPathProblems(key string, downloadPath string) []problem {
+
+	if len(downloadPath) == 0 {
+		return nil
+	}
+
+	if _, err := template.New("").Parse(downloadPath); err != nil {
+		return []problem{problemf(key, "invalid template: %v", err)}
+	}
+	if !path.IsAbs(downloadPath) {
+		return []problem{problemf(key, "must be an absolute path: %q", downloadPath)}
+	}
+
+	return nil
+}
+
+// templateFields returns the fields of dot used by the template, the bodies
+// of range and with blocks are skipped as they change dot
+func templateFields(node parse.Node) [][]string {
+
+	var fields [][]string
+
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node != nil {
+			for _, n := range node.Nodes {
+				fields = append(fields, templateFields(n)...)
+			}
+		}
+	case *parse.ActionNode:
+		fields = templateFields(node.Pipe)
+	case *parse.IfNode:
+		fields = append(templateFields(node.Pipe), templateFields(node.List)...)
+		fields = append(fields, templateFields(node.ElseList)...)
+	case *parse.RangeNode:
+		fields = append(templateFields(node.Pipe), templateFields(node.ElseList)...)
+	case *parse.WithNode:
+		fields = append(templateFields(node.Pipe), templateFields(node.ElseList)...)
+	case *parse.TemplateNode:
+		fields = templateFields(node.Pipe)
+	case *parse.PipeNode:
+		if node != nil {
+			for _, cmd := range node.Cmds {
+				fields = append(fields, templateFields(cmd)...)
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			fields = append(fields, templateFields(arg)...)
+		}
+	case *parse.FieldNode:
+		fields = append(fields, node.Ident)
+	}
+
+	return fields
+}
+
+// templateProblems checks that the download path template only uses the item
+// fields, the release fields and the named groups of the matcher regexp
+func templateProblems(key string, downloadPath string, expr string) []problem {
+
+	tmpl, err := template.New("").Parse(downloadPath)
+	if err != nil {
+		return nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil
+	}
+
+	names := append(append([]string{}, pathFields...), re.SubexpNames()...)
+
+	var problems []problem
+
+	for _, field := range templateFields(tmpl.Tree.Root) {
+		name := "." + strings.Join(field, ".")
+		if !containString(names, field[0]) {
+			problems = append(problems, problemf(key, "unknown template field %v, expected a named group of the regexp or one of %v", name, strings.Join(pathFields, ", ")))
+		} else if field[0] == "release" && len(field) > 1 && !containString(release.FieldNames, field[1]) {
+			problems = append(problems, problemf(key, "unknown template field %v, expected one of %v", name, strings.Join(release.FieldNames, ", ")))
+		}
+	}
+
+	return problems
+}
+
+// problems checks the config values that can not be fixed by defaults
+func (config *Config) problems() []problem {
+
+	var problems []problem
+
+	if len(config.Server.Host) == 0 {
+		problems = append(problems, problemf("server.host", "must be set"))
+	}
+	if config.Server.Port <= 0 || config.Server.Port > 65535 {
+		problems = append(problems, problemf("server.port", "out of range [1, 65535]: %v", config.Server.Port))
+	}
+	if config.Server.RateTime < 0 {
+		problems = append(problems, problemf("server.rateTime", "must not be negative: %v", config.Server.RateTime))
+	}
+	if len(config.Server.Proxy) != 0 {
+		if msg := checkURL(config.Server.Proxy, validProxySchemes); len(msg) != 0 {
+			problems = append(problems, problemf("server.proxy", "%v", msg))
+		}
+	}
+	if len(config.Proxy) != 0 {
+		if msg := checkURL(config.Proxy, validProxySchemes); len(msg) != 0 {
+			problems = append(problems, problemf("proxy", "%v", msg))
+		}
+	}
+	if config.Connect.Retries <= 0 {
+		problems = append(problems, problemf("connection.retries", "must be positive: %v", config.Connect.Retries))
+	}
+	if config.Connect.WaitTime < 0 {
+		problems = append(problems, problemf("connection.waitTime", "must not be negative: %v", config.Connect.WaitTime))
+	}
+	if config.Connect.Timeout < 0 {
+		problems = append(problems, problemf("connection.timeout", "must not be negative: %v", config.Connect.Timeout))
+	}
+	if config.Connect.RateTime < 0 {
+		problems = append(problems, problemf("connection.rateTime", "must not be negative: %v", config.Connect.RateTime))
+	}
+	if !containString(validLogLevels, config.Log.Level) {
+		problems = append(problems, problemf("log.level", "must be one of %v: %q", strings.Join(validLogLevels, ", "), config.Log.Level))
+	}
+	if config.Interval <= 0 {
+		problems = append(problems, problemf("interval", "must be positive: %v", config.Interval))
+	}
+	if config.Jitter < 0 {
+		problems = append(problems, problemf("jitter", "must not be negative: %v", config.Jitter))
+	}
+	if len(config.SeenFile) == 0 {
+		problems = append(problems, problemf("seenFile", "must be set"))
+	}
+	if config.SeenRetention < 0 {
+		problems = append(problems, problemf("seenRetention", "must not be negative: %v", time.Duration(config.SeenRetention)))
+	}
+	if len(config.RSSFile) == 0 {
+		problems = append(problems, problemf("rssFile", "must be set"))
+	}
+	if len(config.CacheFile) == 0 {
+		problems = append(problems, problemf("cacheFile", "must be set"))
+	}
+	if len(config.HistoryFile) == 0 {
+		problems = append(problems, problemf("historyFile", "must be set"))
+	}
+	if len(config.UID) != 0 {
+		problems = append(problems, uidProblems("uid", config.UID)...)
+	}
+	if !containString(validStates, config.State) {
+		problems = append(problems, problemf("state", "must be one of %v: %q", strings.Join(validStates, ", "), config.State))
+	}
+	if config.State == "bolt" && len(config.StateFile) == 0 {
+		problems = append(problems, problemf("stateFile", "must be set"))
+	}
+
+	problems = append(problems, config.Defaults.problems("defaults")...)
+
+	return problems
+}
+
+// problems checks the defaults of the config or a feed
+func (defaults Defaults) problems(key string) []problem {
+
+	problems := downloadPathProblems(key+".downloadPath", defaults.DownloadPath)
+
+	return append(problems, defaults.AddOptions.problems(key)...)
+}
+
+// problems checks that every feed and matcher can be used by the client with
+// the global defaults
+func (rssFeed *FeedConfig) problems(defaults Defaults) []problem {
+
+	var problems []problem
+
+	for i, feed := range rssFeed.Feeds {
+
+		feedPath := fmt.Sprintf("feeds.%v", i)
+
+		if len(feed.URL) == 0 {
+			problems = append(problems, problemf(feedPath+".url", "must be set"))
+		} else if msg := checkURL(feed.URL, validFeedSchemes); len(msg) != 0 {
+			problems = append(problems, problemf(feedPath+".url", "%v", msg))
+		}
+		if len(feed.Proxy) != 0 {
+			if msg := checkURL(feed.Proxy, validProxySchemes); len(msg) != 0 {
+				problems = append(problems, problemf(feedPath+".proxy", "%v", msg))
+			}
+		}
+		if feed.Interval < 0 {
+			problems = append(problems, problemf(feedPath+".interval", "must not be negative: %v", feed.Interval))
+		}
+		if len(feed.UID) != 0 {
+			problems = append(problems, uidProblems(feedPath+".uid", feed.UID)...)
+		}
+
+		problems = append(problems, feed.Defaults.problems(feedPath+".defaults")...)
+
+		for j, matcher := range feed.Matchers {
+
+			matcherPath := fmt.Sprintf("%v.matchers.%v", feedPath, j)
+			problems = append(problems, matcher.problems(matcherPath)...)
+
+			// Inherited paths are reported at the matcher using them
+			downloadPath := matcher.WithDefaults(feed.Defaults).WithDefaults(defaults).DownloadPath
+			problems = append(problems, templateProblems(matcherPath+".downloadPath", downloadPath, matcher.RegExp)...)
+		}
+	}
+
+	return problems
+}
+
+// problems checks the regexps, paths and ranges of the matcher
+func (matcher Matcher) problems(key string) []problem {
+
+	var problems []problem
+
+	if _, err := regexp.Compile(matcher.RegExp); err != nil {
+		problems = append(problems, problemf(key+".regexp", "%v", err))
+	}
+
+	problems = append(problems, downloadPathProblems(key+".downloadPath", matcher.DownloadPath)...)
+
+	for k, expr := range matcher.Include {
+		if _, err := regexp.Compile(expr); err != nil {
+			problems = append(problems, problemf(fmt.Sprintf("%v.include.%v", key, k), "%v", err))
+		}
+	}
+	for k, expr := range matcher.Exclude {
+		if _, err := regexp.Compile(expr); err != nil {
+			problems = append(problems, problemf(fmt.Sprintf("%v.exclude.%v", key, k), "%v", err))
+		}
+	}
+	for name, expr := range matcher.Attributes {
+		if _, err := regexp.Compile(expr); err != nil {
+			problems = append(problems, problemf(key+".attributes."+name, "%v", err))
+		}
+	}
+	for name, expr := range matcher.Release {
+		if !containString(release.FieldNames, name) {
+			problems = append(problems, problemf(key+".release."+name, "must be one of %v: %q", strings.Join(release.FieldNames, ", "), name))
+		} else if _, err := regexp.Compile(expr); err != nil {
+			problems = append(problems, problemf(key+".release."+name, "%v", err))
+		}
+	}
+
+	if matcher.MinSize < 0 {
+		problems = append(problems, problemf(key+".minSize", "must not be negative: %v", matcher.MinSize))
+	}
+	if matcher.MaxSize < 0 {
+		problems = append(problems, problemf(key+".maxSize", "must not be negative: %v", matcher.MaxSize))
+	}
+	if matcher.MaxSize > 0 && matcher.MinSize > matcher.MaxSize {
+		problems = append(problems, problemf(key+".minSize", "greater than maxSize: %v > %v", matcher.MinSize, matcher.MaxSize))
+	}
+	if matcher.MinSeeders < 0 {
+		problems = append(problems, problemf(key+".minSeeders", "must not be negative: %v", matcher.MinSeeders))
+	}
+	if matcher.MaxAge < 0 {
+		problems = append(problems, problemf(key+".maxAge", "must not be negative: %v", time.Duration(matcher.MaxAge)))
+	}
+	for k, upgrade := range matcher.Upgrades {
+		if !containString(validUpgrades, upgrade) {
+			problems = append(problems, problemf(fmt.Sprintf("%v.upgrades.%v", key, k), "must be one of %v: %q", strings.Join(validUpgrades, ", "), upgrade))
+		}
+	}
+	for k, quality := range matcher.Qualities {
+		if !containString(validQualities, quality) {
+			problems = append(problems, problemf(fmt.Sprintf("%v.qualities.%v", key, k), "must be one of %v: %q", strings.Join(validQualities, ", "), quality))
+		}
+	}
+	if len(matcher.Cutoff) != 0 && !containString(matcher.Qualities, matcher.Cutoff) {
+		problems = append(problems, problemf(key+".cutoff", "must be one of the qualities: %q", matcher.Cutoff))
+	}
+	if containString(matcher.Upgrades, "quality") && len(matcher.Qualities) == 0 {
+		problems = append(problems, problemf(key+".upgrades", "quality upgrades require qualities"))
+	}
+	if matcher.Wait < 0 {
+		problems = append(problems, problemf(key+".wait", "must not be negative: %v", time.Duration(matcher.Wait)))
+	}
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"upgrades", len(matcher.Upgrades) != 0},
+		{"qualities", len(matcher.Qualities) != 0},
+		{"wait", matcher.Wait != 0},
+	} {
+		if option.set && !matcher.Episodes {
+			problems = append(problems, problemf(key+"."+option.name, "requires episodes"))
+		}
+	}
+
+	return append(problems, matcher.AddOptions.problems(key)...)
+}
+
+// problems checks the add options, their keys are inline in the matcher or defaults
+func (opts AddOptions) problems(key string) []problem {
+
+	var problems []problem
+
+	if opts.BandwidthPriority != nil && (*opts.BandwidthPriority < -1 || *opts.BandwidthPriority > 1) {
+		problems = append(problems, problemf(key+".bandwidthPriority", "out of range [-1, 1]: %v", *opts.BandwidthPriority))
+	}
+	if opts.PeerLimit != nil && *opts.PeerLimit < 0 {
+		problems = append(problems, problemf(key+".peerLimit", "must not be negative: %v", *opts.PeerLimit))
+	}
+	if opts.QueuePosition != nil && *opts.QueuePosition < 0 {
+		problems = append(problems, problemf(key+".queuePosition", "must not be negative: %v", *opts.QueuePosition))
+	}
+	for k, label := range opts.Labels {
+		if len(label) == 0 || strings.Contains(label, ",") {
+			problems = append(problems, problemf(fmt.Sprintf("%v.labels.%v", key, k), "invalid label: %q", label))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+
+	var tests = []struct {
+		filename string
+		expected []string
+	}{
+		{"../test/config/valid.yml", nil},
+		{"../test/config/unknown.yml", []string{"../test/config/unknown.yml: open ../test/config/unknown.yml: no such file or directory"}},
+		{"../test/config/wrong.yml", []string{"../test/config/wrong.yml:4: did not find expected key"}},
+		{
+			"../test/config/invalid.yml",
+			[]string{
+				"../test/config/invalid.yml:3: unknown key rpsPath",
+				"../test/config/invalid.yml:4: server.port: out of range [1, 65535]: 99999",
+				"../test/config/invalid.yml:6: log.level: must be one of Debug, Info, Warning, Error: \"Verbose\"",
+				"../test/feed/invalid.yml:6: Invalid size: \"12 XB\"",
+				"../test/feed/invalid.yml:12: unknown key seedRatioLimit",
+				"../test/feed/invalid.yml:2: feeds.0.url: invalid url \"feed.com\", expected http|https://host",
+				"../test/feed/invalid.yml:4: feeds.0.matchers.0.regexp: error parsing regexp: missing closing ): `regexp0(`",
+				"../test/feed/invalid.yml:5: feeds.0.matchers.0.downloadPath: must be an absolute path: \"downloads\"",
+				"../test/feed/invalid.yml:10: feeds.0.matchers.1.exclude.1: error parsing regexp: missing closing ]: `[`",
+				"../test/feed/invalid.yml:11: feeds.0.matchers.1.bandwidthPriority: out of range [-1, 1]: 3",
+			},
+		},
+	}
+
+	for idx, test := range tests {
+
+		conf, feeds, err := LoadConfig(test.filename)
+
+		if test.expected == nil {
+			if err != nil || conf == nil || feeds == nil {
+				t.Errorf("Test %v Failed: unexpected error %v", idx, err)
+			}
+			continue
+		}
+
+		validationErr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("Test %v Failed: expected ValidationError got %v", idx, err)
+			continue
+		}
+
+		if len(validationErr.Errors) != len(test.expected) {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, err, test.expected)
+			continue
+		}
+
+		for i, fieldErr := range validationErr.Errors {
+			if fieldErr.Error() != test.expected[i] {
+				t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, fieldErr, test.expected[i])
+			}
+		}
+	}
+}
+
+func TestNodeLine(t *testing.T) {
+
+	node, errs := decodeStrict("../test/feed/feed1.yml", &FeedConfig{})
+	if len(errs) != 0 {
+		t.Fatalf("%v", errs)
+	}
+
+	var tests = []struct {
+		path     string
+		expected int
+	}{
+		{"feeds", 1},
+		{"feeds.0.url", 2},
+		{"feeds.0.matchers.1.onlyTrusted", 10},
+		{"feeds.1.proxy", 19},
+		{"feeds.1.defaults.downloadPath", 14},
+		{"feeds.5.url", 1},
+	}
+
+	for idx, test := range tests {
+
+		line := nodeLine(node, test.path)
+
+		if line != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, line, test.expected)
+		}
+	}
+}
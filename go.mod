@@ -6,7 +6,9 @@ require (
 	github.com/BurntSushi/toml v0.3.1 // indirect
 	github.com/akamensky/argparse v1.2.2
 	github.com/sirupsen/logrus v1.7.0
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/time v0.0.0-20201208040808-7e3f01d25324
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
-	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,507 @@
+package helper
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/whatust/transmission-rss/logger"
+)
+
+var (
+	seenBucket      = []byte("seen")
+	seenAddedBucket = []byte("seenAdded")
+	cacheBucket     = []byte("cache")
+	historyBucket   = []byte("history")
+	pendingBucket   = []byte("pending")
+)
+
+// BoltDB embedded database holding the seen entries, the feed cache, the
+// episode history and the pending torrents, entries are looked up and written
+// when used instead of being loaded at startup
+type BoltDB struct {
+	db *bolt.DB
+}
+
+// OpenBoltDB opens or creates the database, it fails when another instance
+// keeps it open
+func OpenBoltDB(fileName string) (*BoltDB, error) {
+
+	db, err := bolt.Open(fileName, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{seenBucket, seenAddedBucket, cacheBucket, historyBucket, pendingBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltDB{db: db}, nil
+}
+
+// Close ...
+func (b *BoltDB) Close() error {
+	return b.db.Close()
+}
+
+// get decodes the JSON value of the key, false when it is missing
+func (b *BoltDB) get(bucket []byte, key string, value interface{}) (bool, error) {
+
+	var found bool
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, value)
+	})
+
+	return found, err
+}
+
+// put stores the value of the key as JSON
+func (b *BoltDB) put(bucket []byte, key string, value interface{}) error {
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), data)
+	})
+}
+
+// empty returns true when the bucket has no keys
+func (b *BoltDB) empty(bucket []byte) bool {
+
+	empty := true
+
+	b.db.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(bucket).Cursor().First()
+		empty = k == nil
+		return nil
+	})
+
+	return empty
+}
+
+// BoltSeen seen entries of the database, indexed by unique ID and by the time
+// they were added so expired entries are found without a full scan, the
+// reservations are only kept in memory
+type BoltSeen struct {
+	db        *BoltDB
+	Retention time.Duration
+	mu        sync.Mutex
+	reserved  map[string]struct{}
+}
+
+// Seen returns the seen entries of the database
+func (b *BoltDB) Seen(retention time.Duration) *BoltSeen {
+	return &BoltSeen{db: b, Retention: retention}
+}
+
+// addedKey orders the index by added time, the unique ID makes it unique
+func addedKey(entry SeenEntry) []byte {
+
+	key := make([]byte, 8, 8+len(entry.UID))
+	binary.BigEndian.PutUint64(key, uint64(entry.Added.UnixNano()))
+
+	return append(key, entry.UID...)
+}
+
+// putSeen stores the entry and its index key
+func putSeen(tx *bolt.Tx, entry SeenEntry) error {
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(seenBucket).Put([]byte(entry.UID), data); err != nil {
+		return err
+	}
+
+	return tx.Bucket(seenAddedBucket).Put(addedKey(entry), nil)
+}
+
+// LoadSeen imports the seen file into an empty database
+func (seen *BoltSeen) LoadSeen(fileName string) error {
+
+	if !seen.db.empty(seenBucket) {
+		return nil
+	}
+
+	set := SeenSet{Retention: seen.Retention}
+	err := set.LoadSeen(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Importing %v seen entries from %v\n", len(set.Old), fileName)
+
+	return seen.db.db.Update(func(tx *bolt.Tx) error {
+		for _, entry := range set.Old {
+			if err := putSeen(tx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SaveSeen drops the entries older than the retention, the others are
+// written when added
+func (seen *BoltSeen) SaveSeen(fileName string) error {
+
+	if seen.Retention <= 0 {
+		return nil
+	}
+
+	limit := uint64(time.Now().Add(-seen.Retention).UnixNano())
+
+	return seen.db.db.Update(func(tx *bolt.Tx) error {
+
+		entries, index := tx.Bucket(seenBucket), tx.Bucket(seenAddedBucket)
+
+		c := index.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k[:8]) < limit; k, _ = c.First() {
+			if err := entries.Delete(k[8:]); err != nil {
+				return err
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Contain ...
+func (seen *BoltSeen) Contain(uID string) bool {
+
+	var in bool
+
+	err := seen.db.db.View(func(tx *bolt.Tx) error {
+		in = tx.Bucket(seenBucket).Get([]byte(uID)) != nil
+		return nil
+	})
+	if err != nil {
+		logger.Error("Could not look up seen entry %v: %v\n", uID, err)
+	}
+
+	return in
+}
+
+// ContainLegacy returns true when the title was imported from the legacy
+// format
+func (seen *BoltSeen) ContainLegacy(title string) bool {
+
+	var entry SeenEntry
+
+	ok, err := seen.db.get(seenBucket, title, &entry)
+	if err != nil {
+		logger.Error("Could not look up seen entry %v: %v\n", title, err)
+	}
+
+	return ok && err == nil && entry.Legacy
+}
+
+// Reserve marks the item as queued unless it was added or reserved, only
+// one of the callers reserving the same item gets true
+func (seen *BoltSeen) Reserve(uID string) bool {
+
+	seen.mu.Lock()
+	defer seen.mu.Unlock()
+
+	if _, in := seen.reserved[uID]; in || seen.Contain(uID) {
+		return false
+	}
+
+	if seen.reserved == nil {
+		seen.reserved = make(map[string]struct{})
+	}
+	seen.reserved[uID] = struct{}{}
+
+	return true
+}
+
+// Release drops the reservation of an item that was not added
+func (seen *BoltSeen) Release(uID string) {
+
+	seen.mu.Lock()
+	delete(seen.reserved, uID)
+	seen.mu.Unlock()
+}
+
+// AddSeen stores the entry unless its unique ID is already seen and drops
+// its reservation
+func (seen *BoltSeen) AddSeen(entry SeenEntry) {
+
+	if entry.Added.IsZero() {
+		entry.Added = time.Now()
+	}
+	entry.Added = entry.Added.UTC()
+
+	// The entry is stored before the reservation is dropped so it is never
+	// reserved again meanwhile
+	defer seen.Release(entry.UID)
+
+	err := seen.db.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(seenBucket).Get([]byte(entry.UID)) != nil {
+			return nil
+		}
+		return putSeen(tx, entry)
+	})
+	if err != nil {
+		logger.Error("Could not save seen entry %v: %v\n", entry.UID, err)
+	}
+}
+
+// BoltCache feed cache entries of the database
+type BoltCache struct {
+	db *BoltDB
+}
+
+// Cache returns the feed cache of the database
+func (b *BoltDB) Cache() *BoltCache {
+	return &BoltCache{db: b}
+}
+
+// LoadCache imports the cache file into an empty database
+func (cache *BoltCache) LoadCache(fileName string) error {
+
+	if !cache.db.empty(cacheBucket) {
+		return nil
+	}
+
+	var cacheMap CacheMap
+	if err := cacheMap.LoadCache(fileName); err != nil {
+		return err
+	}
+
+	for url, entry := range cacheMap.Entries {
+		if err := cache.db.put(cacheBucket, url, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveCache does nothing, entries are written when set
+func (cache *BoltCache) SaveCache(fileName string) error {
+	return nil
+}
+
+// Get ...
+func (cache *BoltCache) Get(url string) (CacheEntry, bool) {
+
+	var entry CacheEntry
+
+	ok, err := cache.db.get(cacheBucket, url, &entry)
+	if err != nil {
+		logger.Error("Could not read feed cache of %v: %v\n", url, err)
+	}
+
+	return entry, ok && err == nil
+}
+
+// Set ...
+func (cache *BoltCache) Set(url string, entry CacheEntry) {
+
+	if len(entry.ETag) == 0 && len(entry.LastModified) == 0 {
+		cache.Delete(url)
+		return
+	}
+
+	if err := cache.db.put(cacheBucket, url, entry); err != nil {
+		logger.Error("Could not save feed cache of %v: %v\n", url, err)
+	}
+}
+
+// Delete ...
+func (cache *BoltCache) Delete(url string) {
+
+	err := cache.db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(cacheBucket).Delete([]byte(url))
+	})
+	if err != nil {
+		logger.Error("Could not delete feed cache of %v: %v\n", url, err)
+	}
+}
+
+// BoltHistory grabbed episodes of the database, claims are only kept in
+// memory until they are committed
+type BoltHistory struct {
+	db      *BoltDB
+	mu      sync.Mutex
+	pending map[string]HistoryEntry
+}
+
+// History returns the episode history of the database
+func (b *BoltDB) History() *BoltHistory {
+	return &BoltHistory{db: b}
+}
+
+// LoadHistory imports the history file into an empty database
+func (history *BoltHistory) LoadHistory(fileName string) error {
+
+	if !history.db.empty(historyBucket) {
+		return nil
+	}
+
+	var historyMap HistoryMap
+	if err := historyMap.LoadHistory(fileName); err != nil {
+		return err
+	}
+
+	for key, entry := range historyMap.Entries {
+		if err := history.db.put(historyBucket, key, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveHistory does nothing, entries are written when committed
+func (history *BoltHistory) SaveHistory(fileName string) error {
+	return nil
+}
+
+// Get returns the committed entry of the episode
+func (history *BoltHistory) Get(key string) (HistoryEntry, bool) {
+
+	var entry HistoryEntry
+
+	ok, err := history.db.get(historyBucket, key, &entry)
+	if err != nil {
+		logger.Error("Could not read episode history of %v: %v\n", key, err)
+	}
+
+	return entry, ok && err == nil
+}
+
+// Claim reserves the episode for the entry when it was neither grabbed nor
+// claimed, or when upgrade allows replacing the existing entry
+func (history *BoltHistory) Claim(key string, entry HistoryEntry, upgrade func(HistoryEntry) bool) bool {
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if pending, ok := history.pending[key]; ok && (upgrade == nil || !upgrade(pending)) {
+		return false
+	}
+	if grabbed, ok := history.Get(key); ok && (upgrade == nil || !upgrade(grabbed)) {
+		return false
+	}
+
+	if history.pending == nil {
+		history.pending = make(map[string]HistoryEntry)
+	}
+	history.pending[key] = entry
+
+	return true
+}
+
+// Commit records the claimed entry as grabbed
+func (history *BoltHistory) Commit(key string, entry HistoryEntry) {
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.pending[key] == entry {
+		delete(history.pending, key)
+	}
+
+	if err := history.db.put(historyBucket, key, entry); err != nil {
+		logger.Error("Could not save episode history of %v: %v\n", key, err)
+	}
+}
+
+// Release drops the claim of an entry that could not be added
+func (history *BoltHistory) Release(key string, entry HistoryEntry) {
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.pending[key] == entry {
+		delete(history.pending, key)
+	}
+}
+
+// PendingTorrents keeps the torrents that were queued but not added so they
+// are queued again on the next poll, only the state database keeps them
+type PendingTorrents interface {
+	Put(string, interface{})
+	Delete(string)
+	All() map[string][]byte
+}
+
+// BoltPending torrents of the database that were queued but not added yet
+type BoltPending struct {
+	db *BoltDB
+}
+
+// Pending returns the pending torrents of the database
+func (b *BoltDB) Pending() *BoltPending {
+	return &BoltPending{db: b}
+}
+
+// Put stores the torrent as JSON
+func (pending *BoltPending) Put(key string, value interface{}) {
+
+	if err := pending.db.put(pendingBucket, key, value); err != nil {
+		logger.Error("Could not save pending torrent %v: %v\n", key, err)
+	}
+}
+
+// Delete ...
+func (pending *BoltPending) Delete(key string) {
+
+	err := pending.db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).Delete([]byte(key))
+	})
+	if err != nil {
+		logger.Error("Could not delete pending torrent %v: %v\n", key, err)
+	}
+}
+
+// All returns the JSON of every pending torrent by key
+func (pending *BoltPending) All() map[string][]byte {
+
+	all := make(map[string][]byte)
+
+	err := pending.db.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).ForEach(func(k, v []byte) error {
+			// Values are only valid during the transaction
+			all[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	if err != nil {
+		logger.Error("Could not read pending torrents: %v\n", err)
+	}
+
+	return all
+}
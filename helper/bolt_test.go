@@ -0,0 +1,237 @@
+package helper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestDB opens a database in a temporary directory removed by the returned function
+func openTestDB(t *testing.T) (*BoltDB, string, func()) {
+
+	dir, err := ioutil.TempDir("", "transmission-rss")
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	db, err := OpenBoltDB(filepath.Join(dir, "state.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	return db, dir, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBoltSeen(t *testing.T) {
+
+	db, dir, cleanup := openTestDB(t)
+	defer cleanup()
+
+	// An empty database imports the seen file
+	filename := filepath.Join(dir, "seen")
+	content := `{"uid":"old","added":"2000-01-01T00:00:00Z"}
+legacy
+`
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	seen := db.Seen(0)
+	if err := seen.LoadSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	if !seen.ContainLegacy("legacy") || seen.ContainLegacy("old") {
+		t.Errorf("Test Failed: legacy entries not marked on import")
+	}
+
+	now := time.Now()
+
+	seen.AddSeen(SeenEntry{UID: "recent", Added: now.Add(-time.Hour)})
+	seen.AddSeen(SeenEntry{UID: "new"})
+	seen.AddSeen(SeenEntry{UID: "new", Title: "duplicate"})
+
+	var tests = []struct {
+		uid       string
+		retention time.Duration
+		expected  bool
+	}{
+		{"old", 0, true},
+		{"legacy", 0, true},
+		{"recent", 0, true},
+		{"new", 0, true},
+		{"missing", 0, false},
+		{"old", 24 * time.Hour, false},
+		{"legacy", 24 * time.Hour, true},
+		{"recent", 24 * time.Hour, true},
+		{"recent", 30 * time.Minute, false},
+		{"new", 30 * time.Minute, true},
+	}
+
+	for idx, test := range tests {
+
+		seen.Retention = test.retention
+		if err := seen.SaveSeen(filename); err != nil {
+			t.Errorf("Test %v Failed: %v", idx, err)
+		}
+
+		if in := seen.Contain(test.uid); in != test.expected {
+			t.Errorf("Test %v Failed: %v seen %v, expected %v", idx, test.uid, in, test.expected)
+		}
+	}
+
+	// The file is not imported again once the database has entries
+	if err := ioutil.WriteFile(filename, []byte("other\n"), 0644); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	if err := seen.LoadSeen(filename); err != nil || seen.Contain("other") {
+		t.Errorf("Test Failed: seen file imported into a database with entries")
+	}
+}
+
+func TestBoltSeenReserve(t *testing.T) {
+
+	db, _, cleanup := openTestDB(t)
+	defer cleanup()
+
+	seen := db.Seen(0)
+	seen.AddSeen(SeenEntry{UID: "added"})
+
+	if seen.Reserve("added") {
+		t.Errorf("Test Failed: seen entry reserved")
+	}
+	if !seen.Reserve("a") || seen.Reserve("a") {
+		t.Errorf("Test Failed: entry reserved twice")
+	}
+
+	seen.Release("a")
+	if !seen.Reserve("a") {
+		t.Errorf("Test Failed: released entry not reserved")
+	}
+
+	seen.AddSeen(SeenEntry{UID: "a"})
+	if seen.Reserve("a") || !seen.Contain("a") {
+		t.Errorf("Test Failed: added entry reserved")
+	}
+}
+
+func TestBoltCache(t *testing.T) {
+
+	db, dir, cleanup := openTestDB(t)
+	defer cleanup()
+
+	cache := db.Cache()
+
+	if err := cache.LoadCache(filepath.Join(dir, "missing.json")); err != nil {
+		t.Errorf("Test Failed: missing cache file returned %v", err)
+	}
+
+	var tests = []struct {
+		url      string
+		entry    CacheEntry
+		expected bool
+	}{
+		{"http://feed1.com", CacheEntry{ETag: "\"etag\""}, true},
+		{"http://feed2.com", CacheEntry{LastModified: "Sat, 01 Jan 2000 00:00:00 GMT"}, true},
+		{"http://feed3.com", CacheEntry{}, false},
+	}
+
+	for idx, test := range tests {
+
+		cache.Set(test.url, test.entry)
+
+		entry, ok := cache.Get(test.url)
+		if ok != test.expected || entry != test.entry {
+			t.Errorf("Test %v Failed: got %v %v, expected %v %v", idx, entry, ok, test.entry, test.expected)
+		}
+
+		cache.Delete(test.url)
+
+		if _, ok := cache.Get(test.url); ok {
+			t.Errorf("Test %v Failed: entry not deleted", idx)
+		}
+	}
+}
+
+func TestBoltHistory(t *testing.T) {
+
+	db, dir, cleanup := openTestDB(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "history.json")
+
+	added := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	v1 := HistoryEntry{Title: "[Group] Show - 01", Version: 1, Added: added}
+	v2 := HistoryEntry{Title: "[Group] Show - 01v2", Version: 2, Added: added}
+
+	// An empty database imports the history file
+	imported := HistoryMap{}
+	imported.Commit("show E01", v1)
+	if err := imported.SaveHistory(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	history := db.History()
+	if err := history.LoadHistory(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	if entry, ok := history.Get("show E01"); !ok || entry != v1 {
+		t.Errorf("Test Failed: imported entry %v %v, expected %v", entry, ok, v1)
+	}
+
+	newer := func(grabbed HistoryEntry) bool {
+		return v2.Version > grabbed.Version
+	}
+
+	if history.Claim("show E01", v1, nil) {
+		t.Errorf("Test Failed: grabbed episode claimed")
+	}
+	if !history.Claim("show E01", v2, newer) {
+		t.Errorf("Test Failed: upgrade not claimed")
+	}
+	if history.Claim("show E01", v2, newer) {
+		t.Errorf("Test Failed: episode claimed twice")
+	}
+
+	history.Commit("show E01", v2)
+
+	// Committed entries are kept by the database, claims are not
+	history.Claim("show E02", v1, nil)
+
+	reopened := db.History()
+	if entry, ok := reopened.Get("show E01"); !ok || entry != v2 {
+		t.Errorf("Test Failed: committed entry %v %v, expected %v", entry, ok, v2)
+	}
+	if _, ok := reopened.Get("show E02"); ok {
+		t.Errorf("Test Failed: claimed entry saved")
+	}
+}
+
+func TestBoltPending(t *testing.T) {
+
+	db, _, cleanup := openTestDB(t)
+	defer cleanup()
+
+	pending := db.Pending()
+	pending.Put("add:a", HistoryEntry{Title: "a"})
+	pending.Put("held:b", HistoryEntry{Title: "b"})
+	pending.Delete("held:b")
+
+	all := pending.All()
+	if len(all) != 1 {
+		t.Fatalf("Test Failed: pending torrents %q", all)
+	}
+
+	var entry HistoryEntry
+	if err := json.Unmarshal(all["add:a"], &entry); err != nil || entry.Title != "a" {
+		t.Errorf("Test Failed: pending torrent %v %v", entry, err)
+	}
+}
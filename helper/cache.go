@@ -0,0 +1,99 @@
+package helper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/whatust/transmission-rss/logger"
+)
+
+// CacheEntry validators returned by the server with the last feed body and
+// the hash of the matchers that processed it
+type CacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Matchers     string `json:"matchers,omitempty"`
+}
+
+// FeedCache ...
+type FeedCache interface {
+	LoadCache(string) error
+	SaveCache(string) error
+	Get(string) (CacheEntry, bool)
+	Set(string, CacheEntry)
+	Delete(string)
+}
+
+// CacheMap keeps the cache entries by feed URL
+type CacheMap struct {
+	mu      sync.RWMutex
+	Entries map[string]CacheEntry
+}
+
+// LoadCache loads the cache entries, a missing file is an empty cache
+func (cache *CacheMap) LoadCache(fileName string) error {
+
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return json.Unmarshal(data, &cache.Entries)
+}
+
+// SaveCache ...
+func (cache *CacheMap) SaveCache(fileName string) error {
+
+	logger.Info("Saving feed cache...")
+
+	cache.mu.RLock()
+	data, err := json.MarshalIndent(cache.Entries, "", "  ")
+	cache.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fileName, data, 0644)
+}
+
+// Get ...
+func (cache *CacheMap) Get(url string) (CacheEntry, bool) {
+
+	cache.mu.RLock()
+	entry, ok := cache.Entries[url]
+	cache.mu.RUnlock()
+
+	return entry, ok
+}
+
+// Set ...
+func (cache *CacheMap) Set(url string, entry CacheEntry) {
+
+	cache.mu.Lock()
+	if len(entry.ETag) == 0 && len(entry.LastModified) == 0 {
+		delete(cache.Entries, url)
+	} else {
+		if cache.Entries == nil {
+			cache.Entries = make(map[string]CacheEntry)
+		}
+		cache.Entries[url] = entry
+	}
+	cache.mu.Unlock()
+}
+
+// Delete ...
+func (cache *CacheMap) Delete(url string) {
+
+	cache.mu.Lock()
+	delete(cache.Entries, url)
+	cache.mu.Unlock()
+}
@@ -0,0 +1,76 @@
+package helper
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCacheGetSet(t *testing.T) {
+
+	cache := CacheMap{
+		Entries: make(map[string]CacheEntry),
+	}
+
+	var tests = []struct {
+		url      string
+		entry    CacheEntry
+		expected bool
+	}{
+		{"http://feed1.com", CacheEntry{ETag: "\"etag\""}, true},
+		{"http://feed2.com", CacheEntry{LastModified: "Sat, 01 Jan 2000 00:00:00 GMT"}, true},
+		{"http://feed3.com", CacheEntry{}, false},
+	}
+
+	for idx, test := range tests {
+
+		cache.Set(test.url, test.entry)
+
+		entry, ok := cache.Get(test.url)
+		if ok != test.expected || entry != test.entry {
+			t.Errorf("Test %v Failed: got %v %v, expected %v %v", idx, entry, ok, test.entry, test.expected)
+		}
+
+		cache.Delete(test.url)
+
+		if _, ok := cache.Get(test.url); ok {
+			t.Errorf("Test %v Failed: entry not deleted", idx)
+		}
+	}
+}
+
+func TestCacheLoadSave(t *testing.T) {
+
+	filename := "../test/seen/cache.json"
+	defer os.Remove(filename)
+
+	cache := CacheMap{
+		Entries: make(map[string]CacheEntry),
+	}
+
+	err := cache.LoadCache(filename)
+	if err != nil {
+		t.Errorf("Test Failed: missing cache file returned %v", err)
+	}
+
+	cache.Set("http://feed1.com", CacheEntry{ETag: "\"etag\""})
+	cache.Set("http://feed2.com", CacheEntry{LastModified: "Sat, 01 Jan 2000 00:00:00 GMT"})
+
+	err = cache.SaveCache(filename)
+	if err != nil {
+		t.Errorf("Test Failed: %v", err)
+	}
+
+	loaded := CacheMap{
+		Entries: make(map[string]CacheEntry),
+	}
+
+	err = loaded.LoadCache(filename)
+	if err != nil {
+		t.Errorf("Test Failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(cache.Entries, loaded.Entries) {
+		t.Errorf("Test Failed: Loaded cache and saved cache are not equal")
+	}
+}
@@ -0,0 +1,87 @@
+package helper
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// lockFile takes the advisory lock of fileName held on fileName.lock so that
+// several instances do not write the file at the same time, the lock file
+// is kept since removing it would let two processes lock different files
+func lockFile(fileName string, exclusive bool) (*os.File, error) {
+
+	file, err := os.OpenFile(fileName+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := flock(file, exclusive); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// unlockFile releases the lock taken by lockFile
+func unlockFile(file *os.File) error {
+
+	err := funlock(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// writeFileAtomic writes the file through a temporary file synced and then
+// renamed over it, a crash leaves either the old or the new content
+func writeFileAtomic(fileName string, write func(io.Writer) error) error {
+
+	dir, base := filepath.Split(fileName)
+	if len(dir) == 0 {
+		dir = "."
+	}
+
+	tmp, err := ioutil.TempFile(dir, base+".tmp")
+	if err != nil {
+		return err
+	}
+	// Removing fails once the file was renamed
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+
+	err = write(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		return err
+	}
+
+	// The rename is only durable once the directory is synced, some systems
+	// can not sync directories
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "transmission-rss")
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "seen")
+
+	var tests = []struct {
+		content  string
+		err      error
+		expected string
+	}{
+		{"first\n", nil, "first\n"},
+		{"second\n", nil, "second\n"},
+		// A failed write keeps the previous content
+		{"torn", fmt.Errorf("crash"), "second\n"},
+	}
+
+	for idx, test := range tests {
+
+		err := writeFileAtomic(fileName, func(w io.Writer) error {
+			io.WriteString(w, test.content)
+			return test.err
+		})
+
+		if (err != nil) != (test.err != nil) {
+			t.Errorf("Test %v Failed: unexpected error %v", idx, err)
+		}
+
+		data, _ := ioutil.ReadFile(fileName)
+		if string(data) != test.expected {
+			t.Errorf("Test %v Failed:\nGot:      %q\nExpected: %q", idx, data, test.expected)
+		}
+
+		files, _ := ioutil.ReadDir(dir)
+		if len(files) != 1 {
+			t.Errorf("Test %v Failed: temporary files left: %v", idx, len(files)-1)
+		}
+	}
+}
+
+func TestLockFile(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("advisory locks are not supported")
+	}
+
+	dir, err := ioutil.TempDir("", "transmission-rss")
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "seen")
+
+	lock, err := lockFile(fileName, true)
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	locked := make(chan struct{})
+
+	go func() {
+		other, err := lockFile(fileName, true)
+		if err == nil {
+			unlockFile(other)
+		}
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Errorf("Test Failed: lock taken twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlockFile(lock)
+
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Errorf("Test Failed: lock not released")
+	}
+}
@@ -0,0 +1,132 @@
+package helper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/whatust/transmission-rss/logger"
+)
+
+// HistoryEntry release grabbed for an episode
+type HistoryEntry struct {
+	Title   string    `json:"title"`
+	Version int       `json:"version"`
+	Quality string    `json:"quality,omitempty"`
+	Proper  int       `json:"proper,omitempty"`
+	Added   time.Time `json:"added"`
+}
+
+// EpisodeHistory keeps the episodes already grabbed by series so other
+// releases of the same episode are skipped, an episode is claimed while its
+// torrent is being added and then committed or released
+type EpisodeHistory interface {
+	LoadHistory(string) error
+	SaveHistory(string) error
+	Get(string) (HistoryEntry, bool)
+	Claim(string, HistoryEntry, func(HistoryEntry) bool) bool
+	Commit(string, HistoryEntry)
+	Release(string, HistoryEntry)
+}
+
+// HistoryMap keeps the history entries by episode key
+type HistoryMap struct {
+	mu      sync.Mutex
+	Entries map[string]HistoryEntry
+	pending map[string]HistoryEntry
+}
+
+// LoadHistory loads the grabbed episodes, a missing file is an empty history
+func (history *HistoryMap) LoadHistory(fileName string) error {
+
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	return json.Unmarshal(data, &history.Entries)
+}
+
+// SaveHistory saves the committed entries, claimed ones are not saved
+func (history *HistoryMap) SaveHistory(fileName string) error {
+
+	logger.Info("Saving episode history...")
+
+	history.mu.Lock()
+	data, err := json.MarshalIndent(history.Entries, "", "  ")
+	history.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fileName, data, 0644)
+}
+
+// Get returns the committed entry of the episode
+func (history *HistoryMap) Get(key string) (HistoryEntry, bool) {
+
+	history.mu.Lock()
+	entry, ok := history.Entries[key]
+	history.mu.Unlock()
+
+	return entry, ok
+}
+
+// Claim reserves the episode for the entry when it was neither grabbed nor
+// claimed, or when upgrade allows replacing the existing entry, upgrade may
+// be nil to never replace it
+func (history *HistoryMap) Claim(key string, entry HistoryEntry, upgrade func(HistoryEntry) bool) bool {
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if pending, ok := history.pending[key]; ok && (upgrade == nil || !upgrade(pending)) {
+		return false
+	}
+	if grabbed, ok := history.Entries[key]; ok && (upgrade == nil || !upgrade(grabbed)) {
+		return false
+	}
+
+	if history.pending == nil {
+		history.pending = make(map[string]HistoryEntry)
+	}
+	history.pending[key] = entry
+
+	return true
+}
+
+// Commit records the claimed entry as grabbed
+func (history *HistoryMap) Commit(key string, entry HistoryEntry) {
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.pending[key] == entry {
+		delete(history.pending, key)
+	}
+
+	if history.Entries == nil {
+		history.Entries = make(map[string]HistoryEntry)
+	}
+	history.Entries[key] = entry
+}
+
+// Release drops the claim of an entry that could not be added
+func (history *HistoryMap) Release(key string, entry HistoryEntry) {
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.pending[key] == entry {
+		delete(history.pending, key)
+	}
+}
@@ -0,0 +1,109 @@
+package helper
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryClaim(t *testing.T) {
+
+	history := HistoryMap{
+		Entries: make(map[string]HistoryEntry),
+	}
+
+	newer := func(old HistoryEntry) func(HistoryEntry) bool {
+		return func(grabbed HistoryEntry) bool {
+			return old.Version > grabbed.Version
+		}
+	}
+
+	v1 := HistoryEntry{Title: "[Group] Show - 01", Version: 1}
+	v2 := HistoryEntry{Title: "[Group] Show - 01v2", Version: 2}
+	other := HistoryEntry{Title: "[Other] Show - 01", Version: 1}
+
+	var tests = []struct {
+		action   string
+		entry    HistoryEntry
+		upgrade  bool
+		expected bool
+	}{
+		{"claim", v1, false, true},
+		{"claim", other, false, false},
+		{"release", v1, false, true},
+		{"claim", other, false, true},
+		{"commit", other, false, true},
+		{"claim", v1, false, false},
+		{"claim", v2, false, false},
+		{"claim", v2, true, true},
+		{"claim", v2, true, false},
+		{"commit", v2, false, true},
+	}
+
+	for idx, test := range tests {
+
+		ok := true
+
+		switch test.action {
+		case "claim":
+			var upgrade func(HistoryEntry) bool
+			if test.upgrade {
+				upgrade = newer(test.entry)
+			}
+			ok = history.Claim("show E01", test.entry, upgrade)
+		case "commit":
+			history.Commit("show E01", test.entry)
+			entry, _ := history.Get("show E01")
+			ok = entry == test.entry
+		case "release":
+			history.Release("show E01", test.entry)
+		}
+
+		if ok != test.expected {
+			t.Errorf("Test %v Failed: %v %v returned %v, expected %v", idx, test.action, test.entry.Title, ok, test.expected)
+		}
+	}
+}
+
+func TestHistoryLoadSave(t *testing.T) {
+
+	filename := "../test/seen/history.json"
+	defer os.Remove(filename)
+
+	history := HistoryMap{
+		Entries: make(map[string]HistoryEntry),
+	}
+
+	err := history.LoadHistory(filename)
+	if err != nil {
+		t.Errorf("Test Failed: missing history file returned %v", err)
+	}
+
+	added := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	history.Commit("show S01E01", HistoryEntry{Title: "Show S01E01", Version: 1, Added: added})
+	history.Claim("show S01E02", HistoryEntry{Title: "Show S01E02", Version: 1, Added: added}, nil)
+
+	err = history.SaveHistory(filename)
+	if err != nil {
+		t.Errorf("Test Failed: %v", err)
+	}
+
+	loaded := HistoryMap{
+		Entries: make(map[string]HistoryEntry),
+	}
+
+	err = loaded.LoadHistory(filename)
+	if err != nil {
+		t.Errorf("Test Failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(history.Entries, loaded.Entries) {
+		t.Errorf("Test Failed: Loaded history and saved history are not equal")
+	}
+
+	if _, ok := loaded.Get("show S01E02"); ok {
+		t.Errorf("Test Failed: claimed entry saved")
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package helper
+
+import (
+	"os"
+	"syscall"
+)
+
+// flock takes an advisory lock on the file, waiting for the other processes
+// holding it
+func flock(file *os.File, exclusive bool) error {
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// funlock releases the advisory lock of the file
+func funlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package helper
+
+import (
+	"os"
+)
+
+// flock does nothing, advisory locks are not supported on Windows
+func flock(file *os.File, exclusive bool) error {
+	return nil
+}
+
+// funlock does nothing, advisory locks are not supported on Windows
+func funlock(file *os.File) error {
+	return nil
+}
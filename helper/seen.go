@@ -2,100 +2,362 @@ package helper
 
 import (
 	"bufio"
-	"fmt"
+	"bytes"
+	"encoding/json"
+	"io"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/whatust/transmission-rss/logger"
 )
 
-// SeenTorrent ...
+// SeenEntry record of an item added to Transmission, stored one JSON object
+// per line in the seen file
+type SeenEntry struct {
+	UID      string    `json:"uid"`
+	Title    string    `json:"title,omitempty"`
+	Feed     string    `json:"feed,omitempty"`
+	Matcher  string    `json:"matcher,omitempty"`
+	InfoHash string    `json:"infoHash,omitempty"`
+	Link     string    `json:"link,omitempty"`
+	Added    time.Time `json:"added"`
+	// Legacy entries were read from the legacy format and keyed by title
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// SeenTorrent keeps the items already added, an item is reserved while it is
+// queued so concurrent matches add it only once, and then added to the seen
+// entries or released when it could not be added
 type SeenTorrent interface {
 	LoadSeen(string) error
 	SaveSeen(string) error
 	Contain(string) bool
-	AddSeen(string)
+	ContainLegacy(string) bool
+	Reserve(string) bool
+	AddSeen(SeenEntry)
+	Release(string)
 }
 
-// SeenSet ...
+// SeenSet keeps the seen entries in memory, New holds the entries added
+// since the last save, every access holds mu and saves are serialized by
+// saving so the file is written without blocking the readers
 type SeenSet struct {
-	mu  sync.RWMutex
-	New map[string]struct{}
-	Old map[string]struct{}
+	mu       sync.RWMutex
+	saving   sync.Mutex
+	New      map[string]SeenEntry
+	Old      map[string]SeenEntry
+	reserved map[string]struct{}
+	// Retention drops the entries older than it, zero keeps them forever
+	Retention time.Duration
+	// rewrite is set when the file must be compacted even without new entries
+	rewrite bool
+	// file state after the last load or save, other instances changed the
+	// file when it differs
+	stat os.FileInfo
+}
+
+// parseSeenLine parses a record of the seen file, lines of the legacy format
+// are the bare unique ID of an item added at modTime
+func parseSeenLine(line []byte, modTime time.Time) (SeenEntry, bool, error) {
+
+	var entry SeenEntry
+
+	// Records start with their uid key, anything else is a legacy line
+	if !bytes.HasPrefix(line, []byte(`{"uid":`)) {
+		return SeenEntry{UID: string(line), Title: string(line), Added: modTime, Legacy: true}, true, nil
+	}
+
+	err := json.Unmarshal(line, &entry)
+
+	return entry, false, err
 }
 
-// LoadSeen ...
+// LoadSeen loads the seen entries, files of the legacy format with one
+// unique ID per line are migrated on the next save
 func (set *SeenSet) LoadSeen(fileName string) error {
 
+	set.saving.Lock()
+	defer set.saving.Unlock()
+
+	lock, err := lockFile(fileName, false)
+	if err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	if err := set.readSeen(fileName); err != nil {
+		return err
+	}
+
+	set.mu.Lock()
+	set.prune(time.Now())
+	set.mu.Unlock()
+
+	return nil
+}
+
+// readSeen adds the entries of the file to the saved ones, the file is
+// parsed before taking the set lock
+func (set *SeenSet) readSeen(fileName string) error {
+
 	file, err := os.Open(fileName)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
 	scanner.Split(bufio.ScanLines)
 
-	var aux struct{}
-	for scanner.Scan() {
-		set.Old[scanner.Text()] = aux
+	entries := make(map[string]SeenEntry)
+	rewrite := false
+	lines := 0
+
+	for line := 1; scanner.Scan(); line++ {
+
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		lines++
+
+		entry, legacy, err := parseSeenLine(scanner.Bytes(), info.ModTime().UTC())
+		if err != nil || len(entry.UID) == 0 {
+			logger.Warn("Skipping invalid seen entry at %v:%v\n", fileName, line)
+			rewrite = true
+			continue
+		}
+		if legacy {
+			rewrite = true
+		}
+
+		entries[entry.UID] = entry
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Duplicated entries are compacted on the next save
+	if lines != len(entries) {
+		rewrite = true
 	}
 
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	if set.Old == nil {
+		set.Old = make(map[string]SeenEntry)
+	}
+	for uID, entry := range entries {
+		set.Old[uID] = entry
+	}
+	set.rewrite = set.rewrite || rewrite
+	set.stat = info
+
 	return nil
 }
 
-// SaveSeen ...
+// changed returns true when the file was written since it was last loaded or
+// saved by the set
+func (set *SeenSet) changed(fileName string) bool {
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return false
+	}
+
+	return set.stat == nil ||
+		!os.SameFile(info, set.stat) ||
+		info.Size() != set.stat.Size() ||
+		!info.ModTime().Equal(set.stat.ModTime())
+}
+
+// prune drops the saved entries older than the retention, mu must be held
+func (set *SeenSet) prune(now time.Time) {
+
+	if set.Retention <= 0 {
+		return
+	}
+
+	for uID, entry := range set.Old {
+		if now.Sub(entry.Added) > set.Retention {
+			delete(set.Old, uID)
+			set.rewrite = true
+		}
+	}
+}
+
+// SaveSeen rewrites the file with the deduplicated entries through a
+// temporary file renamed over it while holding the file lock, entries saved
+// by other instances since the file was loaded are kept. Entries added while
+// the file is written are saved next time
 func (set *SeenSet) SaveSeen(fileName string) error {
 
 	logger.Info("Saving seen torrents...")
 
-	file, err := os.OpenFile(
-		fileName,
-		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
-		0644,
-	)
+	set.saving.Lock()
+	defer set.saving.Unlock()
 
+	lock, err := lockFile(fileName, true)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer unlockFile(lock)
 
-	var aux struct{}
-	for k := range set.New {
-		_, err := fmt.Fprintln(file, k)
-		if err != nil {
+	if set.changed(fileName) {
+		if err := set.readSeen(fileName); err != nil {
 			return err
 		}
-		set.Old[k] = aux
 	}
-	set.New = make(map[string]struct{})
+
+	set.mu.Lock()
+
+	set.prune(time.Now())
+
+	if len(set.New) == 0 && !set.rewrite {
+		set.mu.Unlock()
+		return nil
+	}
+
+	saved := make(map[string]SeenEntry, len(set.New))
+	entries := make([]SeenEntry, 0, len(set.Old)+len(set.New))
+
+	for _, entry := range set.Old {
+		entries = append(entries, entry)
+	}
+	for k, entry := range set.New {
+		if _, ok := set.Old[k]; !ok {
+			entries = append(entries, entry)
+		}
+		saved[k] = entry
+	}
+
+	set.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Added.Equal(entries[j].Added) {
+			return entries[i].Added.Before(entries[j].Added)
+		}
+		return entries[i].UID < entries[j].UID
+	})
+
+	err = writeFileAtomic(fileName, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	set.stat, _ = os.Stat(fileName)
+
+	set.mu.Lock()
+	if set.Old == nil {
+		set.Old = make(map[string]SeenEntry)
+	}
+	for k, entry := range saved {
+		set.Old[k] = entry
+		delete(set.New, k)
+	}
+	set.rewrite = false
+	set.mu.Unlock()
 
 	return nil
 }
 
-// Contain ...
+// Contain returns true when the item was added
 func (set *SeenSet) Contain(uID string) bool {
 
-	_, in := set.Old[uID]
-	if in {
-		return true
-	}
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+
+	return set.contain(uID)
+}
+
+// ContainLegacy returns true when the title was added before unique IDs were
+// configurable, entries keyed by title since then are not matched
+func (set *SeenSet) ContainLegacy(title string) bool {
 
 	set.mu.RLock()
-	_, in = set.New[uID]
-	set.mu.RUnlock()
+	defer set.mu.RUnlock()
+
+	if entry, in := set.Old[title]; in {
+		return entry.Legacy
+	}
+	entry, in := set.New[title]
+
+	return in && entry.Legacy
+}
+
+// contain is Contain without locking, mu must be held
+func (set *SeenSet) contain(uID string) bool {
+
+	if _, in := set.Old[uID]; in {
+		return true
+	}
+	_, in := set.New[uID]
 
 	return in
 }
 
-// AddSeen ...
-func (set *SeenSet) AddSeen(uID string) {
+// Reserve marks the item as queued unless it was added or reserved, only
+// one of the callers reserving the same item gets true
+func (set *SeenSet) Reserve(uID string) bool {
 
-	var aux struct{}
+	set.mu.Lock()
+	defer set.mu.Unlock()
 
-	if !set.Contain(uID) {
-		set.mu.Lock()
-		set.New[uID] = aux
-		set.mu.Unlock()
+	if _, in := set.reserved[uID]; in || set.contain(uID) {
+		return false
+	}
+
+	if set.reserved == nil {
+		set.reserved = make(map[string]struct{})
 	}
+	set.reserved[uID] = struct{}{}
+
+	return true
+}
+
+// AddSeen records the entry and drops its reservation, the added time
+// defaults to now
+func (set *SeenSet) AddSeen(entry SeenEntry) {
+
+	if entry.Added.IsZero() {
+		entry.Added = time.Now()
+	}
+	entry.Added = entry.Added.UTC()
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	delete(set.reserved, entry.UID)
+
+	if !set.contain(entry.UID) {
+		if set.New == nil {
+			set.New = make(map[string]SeenEntry)
+		}
+		set.New[entry.UID] = entry
+	}
+}
+
+// Release drops the reservation of an item that was not added
+func (set *SeenSet) Release(uID string) {
+
+	set.mu.Lock()
+	delete(set.reserved, uID)
+	set.mu.Unlock()
 }
@@ -2,17 +2,23 @@ package helper
 
 import (
 	"bufio"
+	"encoding/json"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestContainAdd(t *testing.T) {
 
 	var seen SeenSet = SeenSet{
-		Old: make(map[string]struct{}),
-		New: make(map[string]struct{}),
+		Old: make(map[string]SeenEntry),
+		New: make(map[string]SeenEntry),
 	}
 
 	var tests = []struct {
@@ -28,7 +34,7 @@ func TestContainAdd(t *testing.T) {
 		if output := seen.Contain(test.input); output != test.expected {
 			t.Errorf("Test %v Failed: %v inputted, %v expected, received %v", idx, test.input, test.expected, output)
 		}
-		seen.AddSeen(test.input)
+		seen.AddSeen(SeenEntry{UID: test.input})
 	}
 
 }
@@ -36,11 +42,12 @@ func TestContainAdd(t *testing.T) {
 func TestLoadSave(t *testing.T) {
 
 	var seen SeenSet = SeenSet{
-		Old: make(map[string]struct{}),
-		New: make(map[string]struct{}),
+		Old: make(map[string]SeenEntry),
+		New: make(map[string]SeenEntry),
 	}
 
 	filename := "../test/seen/load"
+	defer os.Remove(filename + ".lock")
 
 	err := seen.LoadSeen(filename)
 	if err != nil {
@@ -62,10 +69,11 @@ func TestLoadSave(t *testing.T) {
 		if output := seen.Contain(test.input); output != test.expected {
 			t.Errorf("Test %v Failed: %v inputted, %v expected, reveived %v", idx, test.input, test.expected, output)
 		}
-		seen.AddSeen(test.input)
+		seen.AddSeen(SeenEntry{UID: test.input})
 	}
 
 	outputname := "../test/seen/save"
+	defer os.Remove(outputname + ".lock")
 	copy(filename, outputname)
 
 	seen.SaveSeen(outputname)
@@ -80,7 +88,11 @@ func TestLoadSave(t *testing.T) {
 	scanner.Split(bufio.ScanLines)
 
 	for scanner.Scan() {
-		if _, ok := seen.Old[scanner.Text()]; !ok {
+		var entry SeenEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Errorf("Test Failed: Invalid entry %v on saved file: %v", scanner.Text(), err)
+		}
+		if _, ok := seen.Old[entry.UID]; !ok {
 			t.Errorf("Test Failed: Unknown entry %v on saved file", scanner.Text())
 		}
 	}
@@ -91,8 +103,8 @@ func TestLoadSave(t *testing.T) {
 	seen.SaveSeen(outputname)
 
 	var seenl SeenSet = SeenSet{
-		Old: make(map[string]struct{}),
-		New: make(map[string]struct{}),
+		Old: make(map[string]SeenEntry),
+		New: make(map[string]SeenEntry),
 	}
 
 	err = seenl.LoadSeen(outputname)
@@ -105,6 +117,343 @@ func TestLoadSave(t *testing.T) {
 	}
 }
 
+func TestParseSeenLine(t *testing.T) {
+
+	modTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	added := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		line     string
+		expected SeenEntry
+		legacy   bool
+		hasError bool
+	}{
+		{"Show - 01", SeenEntry{UID: "Show - 01", Title: "Show - 01", Added: modTime, Legacy: true}, true, false},
+		{"{Show} - 01", SeenEntry{UID: "{Show} - 01", Title: "{Show} - 01", Added: modTime, Legacy: true}, true, false},
+		{
+			`{"uid":"guid:1","title":"Show - 01","feed":"http://feed.com","added":"2021-02-01T00:00:00Z"}`,
+			SeenEntry{UID: "guid:1", Title: "Show - 01", Feed: "http://feed.com", Added: added},
+			false,
+			false,
+		},
+		{
+			`{"uid":"guid:1","title":"Show\n01","added":"2021-02-01T00:00:00Z"}`,
+			SeenEntry{UID: "guid:1", Title: "Show\n01", Added: added},
+			false,
+			false,
+		},
+		{`{"uid":"guid:1","title":"Sh`, SeenEntry{}, false, true},
+	}
+
+	for idx, test := range tests {
+
+		entry, legacy, err := parseSeenLine([]byte(test.line), modTime)
+
+		if (err != nil) != test.hasError {
+			t.Errorf("Test %v Failed: unexpected error %v", idx, err)
+			continue
+		}
+		if !test.hasError && (entry != test.expected || legacy != test.legacy) {
+			t.Errorf("Test %v Failed:\nGot:      %+v %v\nExpected: %+v %v", idx, entry, legacy, test.expected, test.legacy)
+		}
+	}
+}
+
+func TestSeenRetention(t *testing.T) {
+
+	filename := "../test/seen/retention"
+	defer os.Remove(filename)
+	defer os.Remove(filename + ".lock")
+
+	now := time.Now()
+
+	seen := SeenSet{Retention: 24 * time.Hour}
+	seen.AddSeen(SeenEntry{UID: "old", Added: now.Add(-48 * time.Hour)})
+	seen.AddSeen(SeenEntry{UID: "recent", Title: "Show\n01", Added: now.Add(-time.Hour)})
+
+	if err := seen.SaveSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	// The old entry is kept until the next save
+	if !seen.Contain("old") {
+		t.Errorf("Test Failed: entry dropped before being saved")
+	}
+
+	if err := seen.SaveSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	if seen.Contain("old") || !seen.Contain("recent") {
+		t.Errorf("Test Failed: expired entries kept or recent ones dropped")
+	}
+
+	loaded := SeenSet{Retention: 24 * time.Hour}
+	if err := loaded.LoadSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	if len(loaded.Old) != 1 || loaded.Old["recent"].Title != "Show\n01" {
+		t.Errorf("Test Failed: loaded %v", loaded.Old)
+	}
+
+	// Entries of legacy files expire from the time the file was written
+	if err := ioutil.WriteFile(filename, []byte("legacy\n"), 0644); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	os.Chtimes(filename, now.Add(-48*time.Hour), now.Add(-48*time.Hour))
+
+	legacy := SeenSet{Retention: 24 * time.Hour}
+	if err := legacy.LoadSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	if legacy.Contain("legacy") {
+		t.Errorf("Test Failed: expired legacy entry loaded")
+	}
+}
+
+func TestSaveSeenInstances(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "transmission-rss")
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "seen")
+
+	added := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Duplicated entries and a torn last line left by an append
+	content := `{"uid":"a","added":"2021-01-01T00:00:00Z"}
+{"uid":"a","added":"2021-01-01T00:00:00Z"}
+{"uid":"b","added":"2021-01-01T00:00:00Z"}
+{"uid":"c","ad`
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	daemon, cron := SeenSet{}, SeenSet{}
+	if err := daemon.LoadSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	if err := cron.LoadSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	daemon.AddSeen(SeenEntry{UID: "d", Added: added.Add(time.Hour)})
+	cron.AddSeen(SeenEntry{UID: "e", Added: added.Add(2 * time.Hour)})
+
+	if err := daemon.SaveSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	if err := cron.SaveSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	expected := `{"uid":"a","added":"2021-01-01T00:00:00Z"}
+{"uid":"b","added":"2021-01-01T00:00:00Z"}
+{"uid":"d","added":"2021-01-01T01:00:00Z"}
+{"uid":"e","added":"2021-01-01T02:00:00Z"}
+`
+
+	data, _ := ioutil.ReadFile(filename)
+	if string(data) != expected {
+		t.Errorf("Test Failed:\nGot:\n%v\nExpected:\n%v", string(data), expected)
+	}
+
+	// The daemon sees the entries saved by cron on its next save
+	if err := daemon.SaveSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	if !daemon.Contain("e") {
+		t.Errorf("Test Failed: entry saved by another instance not loaded")
+	}
+}
+
+func TestContainLegacy(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "transmission-rss")
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "seen")
+
+	content := `Show - 01
+{"uid":"Show - 02","added":"2021-01-01T00:00:00Z"}
+`
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	// The legacy mark is kept once the file is migrated
+	seen := SeenSet{}
+	if err := seen.LoadSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	if err := seen.SaveSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	seen = SeenSet{}
+	if err := seen.LoadSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	seen.AddSeen(SeenEntry{UID: "Show - 03"})
+
+	var tests = []struct {
+		title    string
+		expected bool
+	}{
+		{"Show - 01", true},
+		{"Show - 02", false},
+		{"Show - 03", false},
+		{"Show - 04", false},
+	}
+
+	for idx, test := range tests {
+		if output := seen.ContainLegacy(test.title); output != test.expected {
+			t.Errorf("Test %v Failed: %v inputted, %v expected, received %v", idx, test.title, test.expected, output)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+
+	seen := SeenSet{}
+	seen.AddSeen(SeenEntry{UID: "added"})
+
+	var tests = []struct {
+		action   string
+		uid      string
+		expected bool
+	}{
+		{"reserve", "a", true},
+		{"reserve", "a", false},
+		{"contain", "a", false},
+		{"release", "a", false},
+		{"reserve", "a", true},
+		{"add", "a", true},
+		{"reserve", "a", false},
+		{"reserve", "added", false},
+		{"release", "b", false},
+		{"reserve", "b", true},
+	}
+
+	for idx, test := range tests {
+
+		var output bool
+
+		switch test.action {
+		case "reserve":
+			output = seen.Reserve(test.uid)
+		case "release":
+			seen.Release(test.uid)
+		case "add":
+			seen.AddSeen(SeenEntry{UID: test.uid})
+			output = seen.Contain(test.uid)
+		case "contain":
+			output = seen.Contain(test.uid)
+		}
+
+		if output != test.expected {
+			t.Errorf("Test %v Failed: %v %v returned %v, expected %v", idx, test.action, test.uid, output, test.expected)
+		}
+	}
+}
+
+func TestSeenSetConcurrent(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "transmission-rss")
+	if err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "seen")
+
+	const items, workers = 200, 8
+
+	seen := SeenSet{}
+	reserved := make([]int32, items)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	// Saves run while the workers read and add entries
+	done := make(chan struct{})
+	saved := make(chan error, 1)
+	go func() {
+		for {
+			if err := seen.SaveSeen(filename); err != nil {
+				saved <- err
+				return
+			}
+			select {
+			case <-done:
+				saved <- seen.SaveSeen(filename)
+				return
+			default:
+			}
+		}
+	}()
+
+	// Every other item fails to be added the first time, it is reserved
+	// again by the same round or the next one
+	for round := 0; round < 2; round++ {
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < items; i++ {
+					uID := strconv.Itoa(i)
+					seen.Contain(uID)
+					if !seen.Reserve(uID) {
+						continue
+					}
+					mu.Lock()
+					reserved[i]++
+					count := reserved[i]
+					mu.Unlock()
+					if i%2 == 0 && count == 1 {
+						seen.Release(uID)
+						continue
+					}
+					seen.AddSeen(SeenEntry{UID: uID})
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	close(done)
+
+	if err := <-saved; err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+
+	for i, count := range reserved {
+		expected := int32(1)
+		if i%2 == 0 {
+			expected = 2
+		}
+		if count != expected {
+			t.Errorf("Test %v Failed: reserved %v times, expected %v", i, count, expected)
+		}
+	}
+
+	loaded := SeenSet{}
+	if err := loaded.LoadSeen(filename); err != nil {
+		t.Fatalf("Test Failed: %v", err)
+	}
+	for i := 0; i < items; i++ {
+		if !loaded.Contain(strconv.Itoa(i)) {
+			t.Errorf("Test %v Failed: entry not saved", i)
+		}
+	}
+}
+
 func copy(src, dst string) error {
 
 	_, err := os.Stat(src)
@@ -4,6 +4,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/whatust/transmission-rss/config"
 	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
 	"os"
 )
 
@@ -77,14 +78,27 @@ func (hook *Hook) Levels() []logrus.Level {
 
 var log *logrus.Logger
 
+// output console output of the logs, the file hook is not affected
+var output io.Writer = os.Stdout
+
+// fileHook hook of the current configuration, closed when replaced
+var fileHook *Hook
+
 func init() {
 	log = logrus.New()
 }
 
+// SetOutput sets the console output kept by the next configurations
+func SetOutput(w io.Writer) {
+
+	output = w
+	log.SetOutput(w)
+}
+
 // ConfigLogger initialize log parameters
 func ConfigLogger(config config.Log) (*logrus.Logger, error) {
 
-	log.SetOutput(os.Stdout)
+	log.SetOutput(output)
 	//log.SetFormatter(&logrus.JSONFormatter{})
 
 	switch config.Level {
@@ -98,8 +112,18 @@ func ConfigLogger(config config.Log) (*logrus.Logger, error) {
 		log.SetLevel(logrus.DebugLevel)
 	}
 
-	hook := NewHook(config)
-	log.AddHook(hook)
+	// Replace previous hooks so the logger can be reconfigured on reload, the
+	// file of the previous hook is closed
+	previous := fileHook
+	fileHook = NewHook(config)
+
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(fileHook)
+	log.ReplaceHooks(hooks)
+
+	if previous != nil {
+		previous.logger.Close()
+	}
 
 	return log, nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -10,7 +11,6 @@ import (
 	"github.com/akamensky/argparse"
 	"github.com/whatust/transmission-rss/client"
 	"github.com/whatust/transmission-rss/config"
-	"github.com/whatust/transmission-rss/helper"
 	"github.com/whatust/transmission-rss/logger"
 )
 
@@ -35,7 +35,7 @@ func main() {
 		"dry-run",
 		&argparse.Options{
 			Required: false,
-			Help:     "Prints out the added torrent files without send it to the RPC client.",
+			Help:     "Prints out the added torrent files without send it to the RPC client, logs go to stderr.",
 		},
 	)
 	daemon := parser.Flag(
@@ -47,6 +47,11 @@ func main() {
 		},
 	)
 
+	validate := parser.NewCommand(
+		"validate",
+		"Checks the config file and the feed list without contacting any server.",
+	)
+
 	// Parse input arguments
 	err := parser.Parse(os.Args)
 	if err != nil {
@@ -54,92 +59,177 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Load configurations
-	conf, err := config.GetConfig(*configFile)
+	// Load and validate configurations before any network activity
+	conf, feedConfig, err := config.LoadConfig(*configFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading configurations: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Invalid configurations:\n%v\n", err)
 		os.Exit(1)
 	}
 
-	// Configure logger
+	if validate.Happened() {
+		fmt.Printf("Configurations are valid: %v %v\n", *configFile, conf.RSSFile)
+		return
+	}
+
+	// Configure logger, a dry run keeps stdout for the report
+	if *dry {
+		logger.SetOutput(os.Stderr)
+	}
 	logger.ConfigLogger(conf.Log)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Could not configure log layer: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Create signal handler when daemonized
+	// Create signal handlers, reload is only available when daemonized
+	ctx, cancel := context.WithCancel(context.Background())
+	go signalHandler(cancel)
+
+	reload := make(chan os.Signal, 1)
 	if *daemon {
-		go signalHandler()
+		signal.Notify(reload, syscall.SIGHUP)
 	}
 
-	// Create transmission client
-	myClient := client.TransmissionClient{}
-	var client client.RSSClient = &myClient
+	// Create feed scheduler
+	scheduler := client.NewScheduler(conf.Interval, conf.Jitter)
 
-	err = client.Initialize(conf)
+	// Load seen torrents, feed cache headers and grabbed episodes
+	st, err := loadState(conf)
 	if err != nil {
-		logger.Error("Could not initialize RPC client: %v", err)
+		logger.Error("Could not open state database: %v\n", err)
 		os.Exit(1)
 	}
-	logger.Info("Client Initialized\n")
+	defer st.close()
 
-	// Load seen torrents
-	var seenTorrent helper.SeenSet = helper.SeenSet{
-		Old: make(map[string]struct{}),
-		New: make(map[string]struct{}),
-	}
+	// Hold episode candidates until the best release is picked, a single
+	// poll picks it right away
+	candidates := client.NewCollector()
 
-	// Load RSS feed list
-	feedConfig, err := config.GetFeedsConfig(conf.RSSFile)
-	if err != nil {
-		logger.Error("Could not parse RSS feed list: %v", err)
-		os.Exit(1)
-	} else {
-		logger.Info("Loaded feed list")
+	// Create transmission client
+	myClient := client.TransmissionClient{
+		DryRun:     *dry,
+		Scheduler:  scheduler,
+		Cache:      st.cache,
+		History:    st.history,
+		Pending:    st.pending,
+		Candidates: candidates,
+		NoWait:     !*daemon,
 	}
+	var rssClient client.RSSClient = &myClient
 
-	err = seenTorrent.LoadSeen(conf.SeenFile)
+	err = rssClient.Initialize(ctx, conf)
 	if err != nil {
-		logger.Error("Could not load seen torrents: %v\n", err)
-	} else {
-		logger.Info("Loaded seen files")
+		logger.Error("Could not initialize RPC client: %v", err)
+		st.close()
+		os.Exit(1)
 	}
+	logger.Info("Client Initialized\n")
 
 	for true {
 
-		// Populate torrent from the feed list
-		client.AddFeeds(feedConfig.Feeds, &seenTorrent)
+		// Populate torrent from the feeds due for polling
+		feeds := scheduler.Due(feedConfig.Feeds, time.Now())
+		rssClient.AddFeeds(ctx, feeds, st.seen)
+		scheduler.Done(feeds, time.Now())
 
-		// Save updates to seen torrents file
-		err = seenTorrent.SaveSeen(conf.SeenFile)
-		if err != nil {
-			logger.Error("Unable to save seen torrents: %v\n", err)
+		// Save updates to seen torrents, feed cache and history
+		if !*dry {
+			st.save(conf)
 		}
 
-		if !*daemon {
+		if !*daemon || ctx.Err() != nil {
 			break
 		}
 
-		time.Sleep(time.Second * 300)
-	}
-
-	logger.Info("Dry Run: %v", *dry)
-}
+		// Wake up at the next poll or when the window of a candidate ends
+		next := scheduler.Next(feedConfig.Feeds)
+		if held := candidates.Next(); !held.IsZero() && held.Before(next) {
+			next = held
+		}
+		timer := time.After(time.Until(next))
+
+	wait:
+		for {
+			select {
+			case <-timer:
+				break wait
+			case <-ctx.Done():
+				break wait
+			case <-reload:
+				logger.Info("Reloading configurations from: %v", *configFile)
+
+				newConf, newFeedConfig, err := config.LoadConfig(*configFile)
+				if err != nil {
+					logger.Error("Could not reload configurations, keeping current ones: %v", err)
+					continue
+				}
+
+				newClient := client.TransmissionClient{
+					DryRun:     *dry,
+					Scheduler:  scheduler,
+					Cache:      st.cache,
+					Pending:    st.pending,
+					Candidates: candidates,
+					NoWait:     !*daemon,
+				}
+
+				// Keep the session unless the server or the login changed
+				if client.SameServer(conf, newConf) {
+					newClient.RPCClient = myClient.RPCClient
+					newClient.DownloadDir = myClient.DownloadDir
+				}
+
+				err = newClient.Initialize(ctx, newConf)
+				if err != nil {
+					logger.Error("Could not initialize RPC client, keeping current one: %v", err)
+					continue
+				}
+
+				st.reload(conf, newConf)
+				newClient.History = st.history
+
+				// Feeds whose matchers changed are retrieved again
+				if !*dry {
+					newClient.DropChanged(newFeedConfig.Feeds)
+				}
+
+				logger.ConfigLogger(newConf.Log)
+
+				scheduler.Interval = time.Duration(newConf.Interval) * time.Second
+				scheduler.Jitter = time.Duration(newConf.Jitter) * time.Second
+
+				myClient = newClient
+				conf = newConf
+				feedConfig = newFeedConfig
+
+				logger.Info("Configurations reloaded")
+
+				// Poll the feeds added by the new list right away
+				break wait
+			}
+		}
 
-func cleanup() {
+		if ctx.Err() != nil {
+			break
+		}
+	}
 
+	logger.Info("Exiting")
 }
 
-func signalHandler() {
+func signalHandler(cancel context.CancelFunc) {
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
 	s := <-sigs
 
-	logger.Info("Signal received: %v\n", s)
+	logger.Info("Signal received: %v, shutting down\n", s)
+	cancel()
+
+	// A second signal forces the exit without waiting for pending adds
+	s = <-sigs
 
-	cleanup()
+	logger.Info("Signal received: %v, forcing exit\n", s)
 	os.Exit(1)
 }
@@ -0,0 +1,363 @@
+package release
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Release fields parsed from a release title, the fields missing from the
+// title are empty or zero, absolute numbered episodes have no season
+type Release struct {
+	Title      string
+	Group      string
+	Show       string
+	Season     int
+	Episode    int
+	EpisodeEnd int
+	Absolute   bool
+	Resolution string
+	Source     string
+	Codec      string
+	Audio      string
+	Languages  []string
+	Batch      bool
+	Version    int
+	Proper     int
+}
+
+// FieldNames names of the fields returned by Fields
+var FieldNames = []string{
+	"group",
+	"show",
+	"season",
+	"episode",
+	"episodeEnd",
+	"resolution",
+	"source",
+	"codec",
+	"audio",
+	"language",
+	"batch",
+	"version",
+	"proper",
+}
+
+// token canonical value of the parts of a title matching a regexp
+type token struct {
+	re    *regexp.Regexp
+	value string
+}
+
+func tokens(pairs ...string) []token {
+
+	var list []token
+	for i := 0; i+1 < len(pairs); i += 2 {
+		list = append(list, token{regexp.MustCompile(`(?i)\b(?:` + pairs[i] + `)\b`), pairs[i+1]})
+	}
+
+	return list
+}
+
+var (
+	extensionRegexp   = regexp.MustCompile(`(?i)\.(?:mkv|mp4|avi|m4v|ts|torrent)$`)
+	leadingTagsRegexp = regexp.MustCompile(`^(?:\s*[\[(][^\])]*[\])])+`)
+	leadingGroup      = regexp.MustCompile(`^\s*\[([^\]]+)\]`)
+	trailingGroup     = regexp.MustCompile(`[^\s-]-([A-Za-z0-9]+)(?:\s*\[[^\]]*\])?\s*$`)
+	notGroups         = regexp.MustCompile(`(?i)^(?:dl|rip|ray|\d+)$`)
+
+	// S01E05, S01E05E06, S01E05-E07, S01E05-07, S01E05v2
+	seasonEpisode = regexp.MustCompile(`(?i)\bS(\d{1,3})[ ._-]?E(\d{1,4})(?:[-~]?E(\d{1,4})|[-~](\d{1,4}))?(?:v(\d+))?\b`)
+	// 1x05, 1x05-06
+	crossEpisode = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})(?:-(\d{2,3}))?(?:v(\d+))?\b`)
+	// [Group] Show - 12v2, [Group] Show S2 - 05, [Group] Show - 01 ~ 12
+	dashEpisode = regexp.MustCompile(`(?i)(?:\bS(\d{1,2}))?\s-\s(\d{1,4})(?:\s?[-~]\s?(\d{1,4}))?(?:v(\d+))?(?:[\s\[(.]|$)`)
+	// Show E1024, Show Episode 12, Show #12
+	absoluteEpisode = regexp.MustCompile(`(?i)(?:\b(?:E|Ep|Episode)[ .]?|#)(\d{1,4})(?:v(\d+))?\b`)
+	// Show S02, Show Season 2
+	seasonPack = regexp.MustCompile(`(?i)\b(?:S|Season[ .]?)(\d{1,2})\b`)
+
+	versionRegexp    = regexp.MustCompile(`(?i)\bv(\d{1,2})\b`)
+	batchRegexp      = regexp.MustCompile(`(?i)\b(?:batch|complete)\b`)
+	properRegexp     = regexp.MustCompile(`(?i)\b(?:proper|repack|rerip)\b`)
+	dimensionsRegexp = regexp.MustCompile(`\b\d{3,4}x(\d{3,4})\b`)
+
+	resolutions = tokens(
+		`2160p|4k|uhd`, "2160p",
+		`1080p|1080i`, "1080p",
+		`720p`, "720p",
+		`576p`, "576p",
+		`480p`, "480p",
+		`360p`, "360p",
+	)
+	sources = tokens(
+		`web[ .-]?dl`, "WEB-DL",
+		`web[ .-]?rip`, "WEBRip",
+		`blu[ .-]?ray|bd[ .-]?rip|br[ .-]?rip|bdremux|bd`, "BluRay",
+		`hdtv`, "HDTV",
+		`dvd[ .-]?rip|dvd`, "DVD",
+		`hd[ .-]?rip`, "HDRip",
+		`web`, "WEB",
+	)
+	codecs = tokens(
+		`x\.?264|h\.?264|avc`, "H.264",
+		`x\.?265|h\.?265|hevc`, "H.265",
+		`av1`, "AV1",
+		`vp9`, "VP9",
+		`xvid`, "XviD",
+	)
+	audios = tokens(
+		`e[ .-]?ac[ .-]?3|ddp(?:\d\.?\d)?`, "EAC3",
+		`ac3|dd(?:\d\.?\d)?`, "AC3",
+		`aac(?:\d\.?\d)?`, "AAC",
+		`flac`, "FLAC",
+		`opus`, "Opus",
+		`truehd`, "TrueHD",
+		`dts(?:[ .-]?hd)?(?:[ .-]?ma)?`, "DTS",
+		`mp3`, "MP3",
+	)
+	languages = tokens(
+		`eng|english`, "english",
+		`jpn|jap|japanese`, "japanese",
+		`vostfr|french|truefrench`, "french",
+		`ger|german`, "german",
+		`spa|spanish|latino`, "spanish",
+		`ita|italian`, "italian",
+		`rus|russian`, "russian",
+		`kor|korean`, "korean",
+		`chs|cht|chinese`, "chinese",
+		`por|portuguese`, "portuguese",
+		`multi(?:[ .-]?subs?)?`, "multi",
+		`dual[ .-]?audio`, "dual audio",
+	)
+)
+
+// match returns the value and position of the first token found in text
+func match(text string, list []token) (string, int) {
+
+	for _, t := range list {
+		if loc := t.re.FindStringIndex(text); loc != nil {
+			return t.value, loc[0]
+		}
+	}
+
+	return "", -1
+}
+
+// atoi converts the submatch n to an integer, zero when it did not match
+func atoi(text string, loc []int, n int) int {
+
+	if loc[2*n] < 0 {
+		return 0
+	}
+
+	value, _ := strconv.Atoi(text[loc[2*n]:loc[2*n+1]])
+
+	return value
+}
+
+// Parse parses a release title in scene (Show.Name.S01E05.1080p.WEB-DL-GROUP)
+// or anime ([Group] Show Name - 05 [1080p]) form
+func Parse(title string) Release {
+
+	r := Release{Title: title, Version: 1}
+
+	name := extensionRegexp.ReplaceAllString(strings.TrimSpace(title), "")
+
+	if m := leadingGroup.FindStringSubmatch(name); m != nil {
+		r.Group = strings.TrimSpace(m[1])
+	}
+
+	text := strings.ReplaceAll(leadingTagsRegexp.ReplaceAllString(name, ""), "_", " ")
+
+	if len(r.Group) == 0 {
+		if m := trailingGroup.FindStringSubmatch(text); m != nil && !notGroups.MatchString(m[1]) {
+			r.Group = m[1]
+		}
+	}
+
+	// The show name ends where the episode marker starts
+	end := r.parseEpisode(text)
+
+	// Tokens are looked up after the show name when it is known
+	tail := text
+	if end >= 0 {
+		tail = text[end:]
+	}
+
+	var positions []int
+
+	for _, field := range []struct {
+		value *string
+		list  []token
+	}{
+		{&r.Resolution, resolutions},
+		{&r.Source, sources},
+		{&r.Codec, codecs},
+		{&r.Audio, audios},
+	} {
+		var pos int
+		*field.value, pos = match(tail, field.list)
+		positions = append(positions, pos)
+	}
+
+	if len(r.Resolution) == 0 {
+		if m := dimensionsRegexp.FindStringSubmatch(tail); m != nil {
+			r.Resolution = m[1] + "p"
+		}
+	}
+
+	for _, t := range languages {
+		if t.re.MatchString(tail) && !containString(r.Languages, t.value) {
+			r.Languages = append(r.Languages, t.value)
+		}
+	}
+
+	if loc := batchRegexp.FindStringIndex(tail); loc != nil {
+		r.Batch = true
+		positions = append(positions, loc[0])
+	}
+
+	if r.Version == 1 {
+		if m := versionRegexp.FindStringSubmatch(tail); m != nil {
+			r.Version, _ = strconv.Atoi(m[1])
+		}
+	}
+
+	r.Proper = len(properRegexp.FindAllString(tail, -1))
+
+	// Without episode the show name ends at the first tag or token
+	if end < 0 {
+		end = len(text)
+		if i := strings.IndexAny(text, "[("); i >= 0 {
+			end = i
+		}
+		for _, pos := range positions {
+			if pos >= 0 && pos < end {
+				end = pos
+			}
+		}
+	}
+
+	r.Show = cleanShow(text[:end])
+
+	return r
+}
+
+// parseEpisode fills the season and episode fields returning the position of
+// the episode marker, -1 when the title has none
+func (r *Release) parseEpisode(text string) int {
+
+	if loc := seasonEpisode.FindStringSubmatchIndex(text); loc != nil {
+		r.Season = atoi(text, loc, 1)
+		r.Episode = atoi(text, loc, 2)
+		r.EpisodeEnd = atoi(text, loc, 3) + atoi(text, loc, 4)
+		r.setVersion(atoi(text, loc, 5))
+		return r.endRange(loc[0])
+	}
+
+	if loc := crossEpisode.FindStringSubmatchIndex(text); loc != nil {
+		r.Season = atoi(text, loc, 1)
+		r.Episode = atoi(text, loc, 2)
+		r.EpisodeEnd = atoi(text, loc, 3)
+		r.setVersion(atoi(text, loc, 4))
+		return r.endRange(loc[0])
+	}
+
+	if loc := dashEpisode.FindStringSubmatchIndex(text); loc != nil {
+		r.Season = atoi(text, loc, 1)
+		r.Absolute = r.Season == 0
+		r.Episode = atoi(text, loc, 2)
+		r.EpisodeEnd = atoi(text, loc, 3)
+		r.setVersion(atoi(text, loc, 4))
+		// An absolute range is a batch of episodes
+		r.Batch = r.EpisodeEnd > r.Episode
+		return r.endRange(loc[0])
+	}
+
+	if loc := absoluteEpisode.FindStringSubmatchIndex(text); loc != nil {
+		r.Absolute = true
+		r.Episode = atoi(text, loc, 1)
+		r.setVersion(atoi(text, loc, 2))
+		return r.endRange(loc[0])
+	}
+
+	if loc := seasonPack.FindStringSubmatchIndex(text); loc != nil {
+		r.Season = atoi(text, loc, 1)
+		r.Batch = true
+		return loc[0]
+	}
+
+	return -1
+}
+
+func (r *Release) setVersion(version int) {
+
+	if version != 0 {
+		r.Version = version
+	}
+}
+
+// endRange sets the end of single episodes and returns pos
+func (r *Release) endRange(pos int) int {
+
+	if r.EpisodeEnd < r.Episode {
+		r.EpisodeEnd = r.Episode
+	}
+
+	return pos
+}
+
+// cleanShow replaces the separators of the show name by spaces
+func cleanShow(show string) string {
+
+	show = strings.Map(func(r rune) rune {
+		if r == '.' {
+			return ' '
+		}
+		return r
+	}, show)
+
+	return strings.Trim(strings.Join(strings.Fields(show), " "), " -")
+}
+
+func containString(list []string, value string) bool {
+
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func itoa(value int) string {
+
+	if value == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(value)
+}
+
+// Fields returns the fields by name as strings, numbers missing from the
+// title are empty and the languages are joined with commas
+func (r Release) Fields() map[string]string {
+
+	return map[string]string{
+		"group":      r.Group,
+		"show":       r.Show,
+		"season":     itoa(r.Season),
+		"episode":    itoa(r.Episode),
+		"episodeEnd": itoa(r.EpisodeEnd),
+		"resolution": r.Resolution,
+		"source":     r.Source,
+		"codec":      r.Codec,
+		"audio":      r.Audio,
+		"language":   strings.Join(r.Languages, ","),
+		"batch":      strconv.FormatBool(r.Batch),
+		"version":    strconv.Itoa(r.Version),
+		"proper":     strconv.Itoa(r.Proper),
+	}
+}
@@ -0,0 +1,324 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	var tests = []struct {
+		title    string
+		expected Release
+	}{
+		// Scene releases
+		{
+			"Show.Name.S01E05.1080p.WEB.H264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Source: "WEB", Codec: "H.264", Version: 1},
+		},
+		{
+			"Show.Name.S01E05.720p.HDTV.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "720p", Source: "HDTV", Codec: "H.264", Version: 1},
+		},
+		{
+			"Show.Name.S02E10.2160p.WEB-DL.DDP5.1.HEVC-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 2, Episode: 10, EpisodeEnd: 10, Resolution: "2160p", Source: "WEB-DL", Codec: "H.265", Audio: "EAC3", Version: 1},
+		},
+		{
+			"Show.Name.S03E01.1080p.BluRay.x265.10bit.AAC5.1-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 3, Episode: 1, EpisodeEnd: 1, Resolution: "1080p", Source: "BluRay", Codec: "H.265", Audio: "AAC", Version: 1},
+		},
+		{
+			"Show.Name.S01E01.1080p.WEBRip.x264.AC3-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 1, EpisodeEnd: 1, Resolution: "1080p", Source: "WEBRip", Codec: "H.264", Audio: "AC3", Version: 1},
+		},
+		{
+			"Show.Name.S01E01.1080p.WEB-DL",
+			Release{Show: "Show Name", Season: 1, Episode: 1, EpisodeEnd: 1, Resolution: "1080p", Source: "WEB-DL", Version: 1},
+		},
+		{
+			"Show.Name.S01E01.1080p.Blu-Ray",
+			Release{Show: "Show Name", Season: 1, Episode: 1, EpisodeEnd: 1, Resolution: "1080p", Source: "BluRay", Version: 1},
+		},
+		{
+			"Show.Name.S01E05.PROPER.720p.HDTV.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "720p", Source: "HDTV", Codec: "H.264", Version: 1, Proper: 1},
+		},
+		{
+			"Show.Name.S01E05.REPACK.PROPER.1080p.WEB.h264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Source: "WEB", Codec: "H.264", Version: 1, Proper: 2},
+		},
+		{
+			"Show Name S01E05 720p HDTV x264-GROUP [eztv]",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "720p", Source: "HDTV", Codec: "H.264", Version: 1},
+		},
+		{
+			"Show Name - S01E05 - Episode Title 1080p",
+			Release{Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Version: 1},
+		},
+		{
+			"Show_Name_S01E05_480p_DVDRip_XviD_MP3",
+			Release{Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "480p", Source: "DVD", Codec: "XviD", Audio: "MP3", Version: 1},
+		},
+		{
+			"Show Name S1E5v2 720p",
+			Release{Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "720p", Version: 2},
+		},
+		{
+			"Show.Name.2021.S01E01.1080p.WEB.H264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name 2021", Season: 1, Episode: 1, EpisodeEnd: 1, Resolution: "1080p", Source: "WEB", Codec: "H.264", Version: 1},
+		},
+		{
+			"Show.Name.S00E03.Special.720p.WEB.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 0, Episode: 3, EpisodeEnd: 3, Resolution: "720p", Source: "WEB", Codec: "H.264", Version: 1},
+		},
+		{
+			"Show.Name.S10E100.1080p.HDTV.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 10, Episode: 100, EpisodeEnd: 100, Resolution: "1080p", Source: "HDTV", Codec: "H.264", Version: 1},
+		},
+		{
+			"Show.Name.S01E01E02.720p.HDTV.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 1, EpisodeEnd: 2, Resolution: "720p", Source: "HDTV", Codec: "H.264", Version: 1},
+		},
+		{
+			"Show.Name.S01E01-E03.1080p.WEB.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 1, EpisodeEnd: 3, Resolution: "1080p", Source: "WEB", Codec: "H.264", Version: 1},
+		},
+		{
+			"Show Name S01E01-03 1080p",
+			Release{Show: "Show Name", Season: 1, Episode: 1, EpisodeEnd: 3, Resolution: "1080p", Version: 1},
+		},
+		{
+			"Show.Name.S01E05.1080p.WEB-DL.DD5.1.H.264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Source: "WEB-DL", Codec: "H.264", Audio: "AC3", Version: 1},
+		},
+		{
+			"Show.Name.S01E05.2160p.UHD.BluRay.TrueHD.Atmos.7.1.HEVC-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "2160p", Source: "BluRay", Codec: "H.265", Audio: "TrueHD", Version: 1},
+		},
+		{
+			"Show.Name.S01E05.1080p.BluRay.DTS-HD.MA.5.1.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Source: "BluRay", Codec: "H.264", Audio: "DTS", Version: 1},
+		},
+		{
+			"Show.Name.S01E05.1080p.WEB.AV1.Opus-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Source: "WEB", Codec: "AV1", Audio: "Opus", Version: 1},
+		},
+		{
+			"Show.Name.S01E05.ITA.ENG.1080p.WEB-DL.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Source: "WEB-DL", Codec: "H.264", Languages: []string{"english", "italian"}, Version: 1},
+		},
+		{
+			"Show.Name.S01E05.MULTi.1080p.WEB.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Source: "WEB", Codec: "H.264", Languages: []string{"multi"}, Version: 1},
+		},
+		{
+			"Show.Name.S01E05.VOSTFR.720p.WEB.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "720p", Source: "WEB", Codec: "H.264", Languages: []string{"french"}, Version: 1},
+		},
+		{
+			"Show.Name.S01E05.German.DL.1080p.WEB.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Source: "WEB", Codec: "H.264", Languages: []string{"german"}, Version: 1},
+		},
+		{
+			"Show Name 1x05 HDTV",
+			Release{Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Source: "HDTV", Version: 1},
+		},
+		{
+			"Show Name 3x07-08 720p",
+			Release{Show: "Show Name", Season: 3, Episode: 7, EpisodeEnd: 8, Resolution: "720p", Version: 1},
+		},
+		{
+			"Show Name S01E05 1920x1080",
+			Release{Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Version: 1},
+		},
+		{
+			"Show Name S01E05 4K HDR",
+			Release{Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Resolution: "2160p", Version: 1},
+		},
+		{
+			"Show.Name.S01E05.mkv",
+			Release{Show: "Show Name", Season: 1, Episode: 5, EpisodeEnd: 5, Version: 1},
+		},
+
+		// Season packs
+		{
+			"Show.Name.S02.1080p.BluRay.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 2, Resolution: "1080p", Source: "BluRay", Codec: "H.264", Batch: true, Version: 1},
+		},
+		{
+			"Show Name Season 3 Complete 720p WEB",
+			Release{Show: "Show Name", Season: 3, Resolution: "720p", Source: "WEB", Batch: true, Version: 1},
+		},
+		{
+			"Show.Name.S01.COMPLETE.720p.HDTV.x264-GROUP",
+			Release{Group: "GROUP", Show: "Show Name", Season: 1, Resolution: "720p", Source: "HDTV", Codec: "H.264", Batch: true, Version: 1},
+		},
+
+		// Anime releases
+		{
+			"[SubsPlease] Show Name - 12 (1080p) [ABCD1234].mkv",
+			Release{Group: "SubsPlease", Show: "Show Name", Episode: 12, EpisodeEnd: 12, Absolute: true, Resolution: "1080p", Version: 1},
+		},
+		{
+			"[SubsPlease] Show Name - 12 (720p) [ABCD1234].mkv",
+			Release{Group: "SubsPlease", Show: "Show Name", Episode: 12, EpisodeEnd: 12, Absolute: true, Resolution: "720p", Version: 1},
+		},
+		{
+			"[Erai-raws] Show Name - 05 [1080p][Multiple Subtitle]",
+			Release{Group: "Erai-raws", Show: "Show Name", Episode: 5, EpisodeEnd: 5, Absolute: true, Resolution: "1080p", Version: 1},
+		},
+		{
+			"[Group] Show Name - 12v2 [720p]",
+			Release{Group: "Group", Show: "Show Name", Episode: 12, EpisodeEnd: 12, Absolute: true, Resolution: "720p", Version: 2},
+		},
+		{
+			"[Group] Show Name - 12 [v3][1080p]",
+			Release{Group: "Group", Show: "Show Name", Episode: 12, EpisodeEnd: 12, Absolute: true, Resolution: "1080p", Version: 3},
+		},
+		{
+			"[Group] Show Name S2 - 05 (1080p)",
+			Release{Group: "Group", Show: "Show Name", Season: 2, Episode: 5, EpisodeEnd: 5, Resolution: "1080p", Version: 1},
+		},
+		{
+			"[Group][Tag] Show Name - 1024",
+			Release{Group: "Group", Show: "Show Name", Episode: 1024, EpisodeEnd: 1024, Absolute: true, Version: 1},
+		},
+		{
+			"[Group] Show Name - 01 [BD 1080p HEVC FLAC]",
+			Release{Group: "Group", Show: "Show Name", Episode: 1, EpisodeEnd: 1, Absolute: true, Resolution: "1080p", Source: "BluRay", Codec: "H.265", Audio: "FLAC", Version: 1},
+		},
+		{
+			"[Group] Show Name - 01 [WEB 1080p x264 AAC][Dual Audio]",
+			Release{Group: "Group", Show: "Show Name", Episode: 1, EpisodeEnd: 1, Absolute: true, Resolution: "1080p", Source: "WEB", Codec: "H.264", Audio: "AAC", Languages: []string{"dual audio"}, Version: 1},
+		},
+		{
+			"[Group] Show Name - 07 (1080p) [ENG][JPN]",
+			Release{Group: "Group", Show: "Show Name", Episode: 7, EpisodeEnd: 7, Absolute: true, Resolution: "1080p", Languages: []string{"english", "japanese"}, Version: 1},
+		},
+		{
+			"[Group] Show Name - 01-12 [1080p] [Batch]",
+			Release{Group: "Group", Show: "Show Name", Episode: 1, EpisodeEnd: 12, Absolute: true, Resolution: "1080p", Batch: true, Version: 1},
+		},
+		{
+			"[Group] Show Name - 01 ~ 24 (BD 1080p)",
+			Release{Group: "Group", Show: "Show Name", Episode: 1, EpisodeEnd: 24, Absolute: true, Resolution: "1080p", Source: "BluRay", Batch: true, Version: 1},
+		},
+		{
+			"[Group] Show Name (Batch) [1080p]",
+			Release{Group: "Group", Show: "Show Name", Resolution: "1080p", Batch: true, Version: 1},
+		},
+		{
+			"[Group] Show Name [1080p][HEVC]",
+			Release{Group: "Group", Show: "Show Name", Resolution: "1080p", Codec: "H.265", Version: 1},
+		},
+		{
+			"[Group] Show Name - 05 [1080p] REPACK",
+			Release{Group: "Group", Show: "Show Name", Episode: 5, EpisodeEnd: 5, Absolute: true, Resolution: "1080p", Version: 1, Proper: 1},
+		},
+		{
+			"[Group] Show.Name - 05 [720p]",
+			Release{Group: "Group", Show: "Show Name", Episode: 5, EpisodeEnd: 5, Absolute: true, Resolution: "720p", Version: 1},
+		},
+		{
+			"[Group] Show Name: Subtitle - 03 (1080p)",
+			Release{Group: "Group", Show: "Show Name: Subtitle", Episode: 3, EpisodeEnd: 3, Absolute: true, Resolution: "1080p", Version: 1},
+		},
+		{
+			"[Group] Show Name 2nd Season - 03 (1080p)",
+			Release{Group: "Group", Show: "Show Name 2nd Season", Episode: 3, EpisodeEnd: 3, Absolute: true, Resolution: "1080p", Version: 1},
+		},
+
+		// Absolute numbering
+		{
+			"Show Name E1024 1080p",
+			Release{Show: "Show Name", Episode: 1024, EpisodeEnd: 1024, Absolute: true, Resolution: "1080p", Version: 1},
+		},
+		{
+			"Show Name Episode 7",
+			Release{Show: "Show Name", Episode: 7, EpisodeEnd: 7, Absolute: true, Version: 1},
+		},
+		{
+			"Show Name Ep.12 720p",
+			Release{Show: "Show Name", Episode: 12, EpisodeEnd: 12, Absolute: true, Resolution: "720p", Version: 1},
+		},
+		{
+			"Show Name #42",
+			Release{Show: "Show Name", Episode: 42, EpisodeEnd: 42, Absolute: true, Version: 1},
+		},
+
+		// Titles without episode
+		{
+			"Show Name 1080p WEB",
+			Release{Show: "Show Name", Resolution: "1080p", Source: "WEB", Version: 1},
+		},
+		{
+			"Movie.Name.2019.1080p.BluRay.x264-GROUP",
+			Release{Group: "GROUP", Show: "Movie Name 2019", Resolution: "1080p", Source: "BluRay", Codec: "H.264", Version: 1},
+		},
+		{
+			"Some Title",
+			Release{Show: "Some Title", Version: 1},
+		},
+		{
+			"",
+			Release{Version: 1},
+		},
+	}
+
+	for idx, test := range tests {
+
+		test.expected.Title = test.title
+
+		release := Parse(test.title)
+
+		if !reflect.DeepEqual(release, test.expected) {
+			t.Errorf("Test %v Failed: %v\nGot:      %+v\nExpected: %+v", idx, test.title, release, test.expected)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+
+	var tests = []struct {
+		title    string
+		expected map[string]string
+	}{
+		{
+			"[Group] Show Name - 12v2 [1080p][ENG][JPN]",
+			map[string]string{
+				"group":      "Group",
+				"show":       "Show Name",
+				"season":     "",
+				"episode":    "12",
+				"episodeEnd": "12",
+				"resolution": "1080p",
+				"source":     "",
+				"codec":      "",
+				"audio":      "",
+				"language":   "english,japanese",
+				"batch":      "false",
+				"version":    "2",
+				"proper":     "0",
+			},
+		},
+	}
+
+	for idx, test := range tests {
+
+		fields := Parse(test.title).Fields()
+
+		if !reflect.DeepEqual(fields, test.expected) {
+			t.Errorf("Test %v Failed:\nGot:      %v\nExpected: %v", idx, fields, test.expected)
+		}
+
+		for _, name := range FieldNames {
+			if _, ok := fields[name]; !ok {
+				t.Errorf("Test %v Failed: field %v missing", idx, name)
+			}
+		}
+		if len(fields) != len(FieldNames) {
+			t.Errorf("Test %v Failed: %v fields, expected %v", idx, len(fields), len(FieldNames))
+		}
+	}
+}
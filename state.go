@@ -0,0 +1,149 @@
+package main
+
+import (
+	"time"
+
+	"github.com/whatust/transmission-rss/config"
+	"github.com/whatust/transmission-rss/helper"
+	"github.com/whatust/transmission-rss/logger"
+)
+
+// state persistent state of the client kept in the seen, cache and history
+// files or in the state database, only the database keeps pending torrents
+type state struct {
+	seen    helper.SeenTorrent
+	cache   helper.FeedCache
+	history helper.EpisodeHistory
+	pending helper.PendingTorrents
+	db      *helper.BoltDB
+}
+
+// loadState opens the state backend of the configuration, an empty database
+// imports the state files
+func loadState(conf *config.Config) (*state, error) {
+
+	s := &state{}
+
+	if conf.State == "bolt" {
+
+		db, err := helper.OpenBoltDB(conf.StateFile)
+		if err != nil {
+			return nil, err
+		}
+
+		s.db = db
+		s.seen = db.Seen(time.Duration(conf.SeenRetention))
+		s.cache = db.Cache()
+		s.history = db.History()
+		s.pending = db.Pending()
+	} else {
+		s.seen = &helper.SeenSet{
+			Old:       make(map[string]helper.SeenEntry),
+			New:       make(map[string]helper.SeenEntry),
+			Retention: time.Duration(conf.SeenRetention),
+		}
+		s.cache = &helper.CacheMap{
+			Entries: make(map[string]helper.CacheEntry),
+		}
+		s.history = &helper.HistoryMap{
+			Entries: make(map[string]helper.HistoryEntry),
+		}
+	}
+
+	s.loadSeen(conf)
+
+	err := s.cache.LoadCache(conf.CacheFile)
+	if err != nil {
+		logger.Error("Could not load feed cache: %v\n", err)
+	}
+
+	s.loadHistory(conf)
+
+	return s, nil
+}
+
+// loadSeen loads the seen torrents
+func (s *state) loadSeen(conf *config.Config) {
+
+	err := s.seen.LoadSeen(conf.SeenFile)
+	if err != nil {
+		logger.Error("Could not load seen torrents: %v\n", err)
+	} else {
+		logger.Info("Loaded seen files")
+	}
+}
+
+// loadHistory loads the grabbed episodes
+func (s *state) loadHistory(conf *config.Config) {
+
+	err := s.history.LoadHistory(conf.HistoryFile)
+	if err != nil {
+		logger.Error("Could not load episode history: %v\n", err)
+	}
+}
+
+// reload applies the new configuration, the state files are loaded again
+// when they changed and the backend can only change on restart
+func (s *state) reload(conf *config.Config, newConf *config.Config) {
+
+	if newConf.State != conf.State || newConf.StateFile != conf.StateFile {
+		logger.Warn("Changing the state backend requires a restart, keeping %v\n", conf.State)
+		newConf.State = conf.State
+		newConf.StateFile = conf.StateFile
+	}
+
+	if s.db != nil {
+		s.seen = s.db.Seen(time.Duration(newConf.SeenRetention))
+		return
+	}
+
+	if newConf.HistoryFile != conf.HistoryFile {
+		s.history = &helper.HistoryMap{
+			Entries: make(map[string]helper.HistoryEntry),
+		}
+		s.loadHistory(newConf)
+	}
+
+	if newConf.SeenFile != conf.SeenFile {
+		s.seen = &helper.SeenSet{
+			Old: make(map[string]helper.SeenEntry),
+			New: make(map[string]helper.SeenEntry),
+		}
+		s.loadSeen(newConf)
+	}
+
+	if seen, ok := s.seen.(*helper.SeenSet); ok {
+		seen.Retention = time.Duration(newConf.SeenRetention)
+	}
+}
+
+// save writes the state changed since the last save
+func (s *state) save(conf *config.Config) {
+
+	err := s.seen.SaveSeen(conf.SeenFile)
+	if err != nil {
+		logger.Error("Unable to save seen torrents: %v\n", err)
+	}
+
+	err = s.cache.SaveCache(conf.CacheFile)
+	if err != nil {
+		logger.Error("Unable to save feed cache: %v\n", err)
+	}
+
+	err = s.history.SaveHistory(conf.HistoryFile)
+	if err != nil {
+		logger.Error("Unable to save episode history: %v\n", err)
+	}
+}
+
+// close closes the state database
+func (s *state) close() {
+
+	if s.db == nil {
+		return
+	}
+
+	if err := s.db.Close(); err != nil {
+		logger.Error("Could not close state database: %v\n", err)
+	}
+}